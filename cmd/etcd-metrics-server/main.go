@@ -1,23 +1,35 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/cfhttp"
 	"code.cloudfoundry.org/cflager"
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/debugserver"
+	"code.cloudfoundry.org/go-loggregator"
 	"code.cloudfoundry.org/lager"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/handlers"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
 	"github.com/cloudfoundry/dropsonde"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
+	"github.com/tedsuo/ifrit/http_server"
 	"github.com/tedsuo/ifrit/sigmon"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 var jobName = flag.String(
@@ -38,6 +50,36 @@ var etcdAddress = flag.String(
 	"etcd host:port to instrument",
 )
 
+var etcdEndpoints = flag.String(
+	"etcdEndpoints",
+	"",
+	"comma-separated etcd host:port list to instrument as a whole cluster, tagging metrics with the member name",
+)
+
+var discoverySRV = flag.String(
+	"discoverySRV",
+	"",
+	"domain whose _etcd-client._tcp or _etcd-server._tcp SRV records (-ssl when -etcdScheme is https) list the members to instrument as a whole cluster",
+)
+
+var discoverySRVInterval = flag.Duration(
+	"discoverySRVInterval",
+	30*time.Second,
+	"interval at which the -discoverySRV records are resolved again",
+)
+
+var discoverMembers = flag.Bool(
+	"discoverMembers",
+	false,
+	"instrument every member of the cluster, listed through the v2 members API of -etcdEndpoints or -etcdAddress",
+)
+
+var discoverMembersInterval = flag.Duration(
+	"discoverMembersInterval",
+	30*time.Second,
+	"interval at which the members listed with -discoverMembers are listed again",
+)
+
 var index = flag.Uint(
 	"index",
 	0,
@@ -80,6 +122,30 @@ var reportInterval = flag.Duration(
 	"interval on which to report metrics",
 )
 
+var scrapeIntervals = flag.String(
+	"scrapeIntervals",
+	"",
+	"comma separated instrument=interval pairs (e.g. server=5s,store=1m) for instruments to be scraped at other intervals than the report interval; members are collected from at the shortest of these intervals when it is shorter than the report interval",
+)
+
+var scrapeJitter = flag.Float64(
+	"scrapeJitter",
+	0.1,
+	"fraction, up to 0.5, of an instrument's interval by which its next scrape is randomly brought forward or delayed",
+)
+
+var unreachableThreshold = flag.Int(
+	"unreachableThreshold",
+	3,
+	"number of ticks in a row on which an etcd member could not be reached before it is only probed, with exponential backoff, until it answers again",
+)
+
+var maxBackoff = flag.Duration(
+	"maxBackoff",
+	5*time.Minute,
+	"longest time to wait between probes of an etcd member that could not be reached",
+)
+
 var caCertFilePath = flag.String(
 	"caCert",
 	"",
@@ -98,6 +164,120 @@ var keyFilePath = flag.String(
 	"Path to the ETCD server key",
 )
 
+var useLoggregatorV2 = flag.Bool(
+	"useLoggregatorV2",
+	false,
+	"send metrics to the loggregator agent over the v2 gRPC API instead of dropsonde",
+)
+
+var loggregatorAgentAddress = flag.String(
+	"loggregatorAgentAddress",
+	"127.0.0.1:3458",
+	"loggregator agent v2 gRPC address",
+)
+
+var loggregatorCACertFilePath = flag.String(
+	"loggregatorCACert",
+	"",
+	"Path to the loggregator agent CA",
+)
+
+var loggregatorCertFilePath = flag.String(
+	"loggregatorCert",
+	"",
+	"Path to the loggregator client cert",
+)
+
+var loggregatorKeyFilePath = flag.String(
+	"loggregatorKey",
+	"",
+	"Path to the loggregator client key",
+)
+
+var statsdAddress = flag.String(
+	"statsdAddress",
+	"",
+	"StatsD/DogStatsD host:port to send metrics to, disabled when empty",
+)
+
+var statsdPrefix = flag.String(
+	"statsdPrefix",
+	"etcd.",
+	"prefix for the names of metrics sent to StatsD",
+)
+
+var graphiteAddress = flag.String(
+	"graphiteAddress",
+	"",
+	"carbon relay host:port to send metrics to, disabled when empty",
+)
+
+var graphitePrefix = flag.String(
+	"graphitePrefix",
+	"etcd",
+	"prefix for the paths of metrics sent to graphite",
+)
+
+var graphiteProtocol = flag.String(
+	"graphiteProtocol",
+	string(runners.GraphitePlaintext),
+	"protocol used to send metrics to graphite (plaintext or pickle)",
+)
+
+var graphiteBufferSize = flag.Int(
+	"graphiteBufferSize",
+	10000,
+	"maximum number of datapoints kept while the carbon relay is unreachable",
+)
+
+var influxDBAddress = flag.String(
+	"influxDBAddress",
+	"",
+	"InfluxDB http(s):// URL or udp://host:port to send metrics to, disabled when empty",
+)
+
+var influxDBDatabase = flag.String(
+	"influxDBDatabase",
+	"etcd",
+	"InfluxDB database to write metrics to over HTTP",
+)
+
+var influxDBBatchSize = flag.Int(
+	"influxDBBatchSize",
+	5000,
+	"maximum number of lines sent to InfluxDB in a single write",
+)
+
+var etcdAPI = flag.String(
+	"etcdAPI",
+	string(runners.EtcdAutoAPI),
+	"etcd API to collect metrics from: v2 for the stats endpoints, v3 for the Prometheus /metrics endpoint, both, or auto to pick one from the etcd version",
+)
+
+var leaderRedirectPolicy = flag.String(
+	"leaderRedirectPolicy",
+	string(instruments.SkipOnFollower),
+	"what to emit for the leader stats on a follower: skip to emit nothing, follow to emit the leader's stats tagged with source=leader, or zero to emit Followers=0",
+)
+
+var counterRates = flag.String(
+	"counterRates",
+	string(runners.RawCounters),
+	"how counters are sent to the sinks: raw as reported by etcd, alongside to add their per-second rates, or instead to send only the rates",
+)
+
+var otlpEndpoint = flag.String(
+	"otlpEndpoint",
+	"",
+	"OTLP/HTTP metrics endpoint (e.g. http://collector:4318/v1/metrics) to export metrics to, disabled when empty",
+)
+
+var otlpEncoding = flag.String(
+	"otlpEncoding",
+	string(runners.OTLPProtobuf),
+	"encoding of OTLP export requests, either protobuf or json",
+)
+
 func main() {
 	debugserver.AddFlags(flag.CommandLine)
 	cflager.AddFlags(flag.CommandLine)
@@ -111,8 +291,10 @@ func main() {
 		return instruments.ErrRedirected
 	}
 
+	var tlsConfig *tls.Config
 	if *caCertFilePath != "" && *certFilePath != "" && *keyFilePath != "" {
-		tlsConfig, err := cfhttp.NewTLSConfig(*certFilePath, *keyFilePath, *caCertFilePath)
+		var err error
+		tlsConfig, err = cfhttp.NewTLSConfig(*certFilePath, *keyFilePath, *caCertFilePath)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
@@ -124,8 +306,58 @@ func main() {
 
 	logger, reconfigurableSink := cflager.New(componentName)
 
+	api := runners.EtcdAPI(*etcdAPI)
+	switch api {
+	case runners.EtcdV2API, runners.EtcdV3API, runners.EtcdBothAPI, runners.EtcdAutoAPI:
+	default:
+		logger.Fatal("invalid-etcd-api", fmt.Errorf("unknown etcd API %q", *etcdAPI))
+	}
+
+	redirectPolicy := instruments.RedirectPolicy(*leaderRedirectPolicy)
+	switch redirectPolicy {
+	case instruments.SkipOnFollower, instruments.FollowToLeader, instruments.ZeroOnFollower:
+	default:
+		logger.Fatal("invalid-leader-redirect-policy", fmt.Errorf("unknown leader redirect policy %q", *leaderRedirectPolicy))
+	}
+
+	intervals, err := runners.ParseScrapeIntervals(*scrapeIntervals)
+	if err == nil {
+		err = intervals.Validate()
+	}
+	if err != nil {
+		logger.Fatal("invalid-scrape-intervals", err)
+	}
+
+	if *scrapeJitter < 0 || *scrapeJitter > 0.5 {
+		logger.Fatal("invalid-scrape-jitter", fmt.Errorf("scrape jitter %v is not between 0 and 0.5", *scrapeJitter))
+	}
+
+	if *unreachableThreshold < 1 {
+		logger.Fatal("invalid-unreachable-threshold", fmt.Errorf("unreachable threshold %d is not positive", *unreachableThreshold))
+	}
+
+	var dial func(string) (*grpc.ClientConn, error)
+	if api != runners.EtcdV2API {
+		dial = func(etcdURL string) (*grpc.ClientConn, error) {
+			return initializeEtcdConn(etcdURL, tlsConfig)
+		}
+	}
+
+	clock := clock.NewClock()
+	registry := instrumentation.NewRegistry(clock)
+
+	discoverer := initializeDiscoverer(client, clock)
+
+	sinks, err := initializeSinks(memberName(discoverer), clock)
+	if err != nil {
+		logger.Fatal("failed-to-initialize-sinks", err)
+	}
+
+	notifier := initializeMetronNotifier(client, dial, discoverer, api, redirectPolicy, intervals, registry, sinks, logger)
+
 	members := grouper.Members{
-		{"metron-notifier", initializeMetronNotifier(client, logger)},
+		{"metron-notifier", notifier},
+		{"http-server", initializeServer(registry, notifier, intervals, clock, logger)},
 	}
 
 	if dbgAddr := debugserver.DebugAddress(flag.CommandLine); dbgAddr != "" {
@@ -137,7 +369,7 @@ func main() {
 	group := grouper.NewOrdered(os.Interrupt, members)
 	monitorProcess := ifrit.Invoke(sigmon.New(group))
 
-	err := <-monitorProcess.Wait()
+	err = <-monitorProcess.Wait()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -150,6 +382,227 @@ func createEtcdURL() *url.URL {
 	}
 }
 
-func initializeMetronNotifier(client *http.Client, logger lager.Logger) *runners.PeriodicMetronNotifier {
-	return runners.NewPeriodicMetronNotifier(client, createEtcdURL().String(), logger, *reportInterval)
+// initializeEtcdConn dials the etcd v3 gRPC API, which members serve on the
+// same port as their HTTP API.
+func initializeEtcdConn(etcdURL string, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
+	parsed, err := url.Parse(etcdURL)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	return grpc.Dial(parsed.Host, grpc.WithTransportCredentials(creds))
+}
+
+// etcdURLs returns the URLs of the members listed in -etcdEndpoints.
+func etcdURLs() []string {
+	urls := []string{}
+	for _, endpoint := range strings.Split(*etcdEndpoints, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+
+		etcdURL := &url.URL{
+			Scheme: *etcdScheme,
+			Host:   endpoint,
+		}
+		urls = append(urls, etcdURL.String())
+	}
+
+	return urls
+}
+
+func initializeDiscoverer(client *http.Client, clock clock.Clock) runners.Discoverer {
+	urls := etcdURLs()
+
+	switch {
+	case *discoverySRV != "":
+		// the server records point at the peer port, so members are reached on
+		// the client port of -etcdAddress instead
+		_, clientPort, err := net.SplitHostPort(*etcdAddress)
+		if err != nil {
+			clientPort = "4001"
+		}
+
+		return runners.NewSRVDiscoverer(
+			net.DefaultResolver,
+			*discoverySRV,
+			*etcdScheme,
+			clientPort,
+			*discoverySRVInterval,
+			client,
+			clock,
+		)
+	case *discoverMembers && len(urls) > 0:
+		return runners.NewV2MembersDiscoverer(client, urls, *discoverMembersInterval, clock)
+	case *discoverMembers:
+		return runners.NewV2MembersDiscoverer(client, []string{createEtcdURL().String()}, *discoverMembersInterval, clock)
+	case len(urls) > 0:
+		return runners.NewStaticDiscoverer(client, urls)
+	default:
+		return runners.NewSingleMemberDiscoverer(client, createEtcdURL().String())
+	}
+}
+
+// memberName returns the name of the member monitored on its own, as it was
+// last discovered. When monitoring a whole cluster metrics are attributed to
+// the member they are tagged with instead.
+func memberName(discoverer runners.Discoverer) func() string {
+	if single, ok := discoverer.(*runners.SingleMemberDiscoverer); ok {
+		return single.Name
+	}
+
+	return func() string { return "" }
+}
+
+func initializeSinks(memberName func() string, clock clock.Clock) ([]runners.Sink, error) {
+	sinks := []runners.Sink{}
+
+	if *useLoggregatorV2 {
+		sink, err := initializeLoggregatorV2Sink()
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	} else {
+		sinks = append(sinks, runners.NewDropsondeSink())
+	}
+
+	if *statsdAddress != "" {
+		sink, err := runners.NewStatsdSink(*statsdAddress, *statsdPrefix)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if *graphiteAddress != "" {
+		sink, err := runners.NewGraphiteSink(
+			*graphiteAddress,
+			*graphitePrefix,
+			runners.GraphiteProtocol(*graphiteProtocol),
+			*graphiteBufferSize,
+			clock,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if *influxDBAddress != "" {
+		sink, err := runners.NewInfluxDBSink(
+			*influxDBAddress,
+			*influxDBDatabase,
+			*influxDBBatchSize,
+			cfhttp.NewClient(),
+			clock,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if *otlpEndpoint != "" {
+		sink, err := runners.NewOTLPSink(
+			*otlpEndpoint,
+			runners.OTLPEncoding(*otlpEncoding),
+			*jobName,
+			strconv.FormatUint(uint64(*index), 10),
+			memberName,
+			cfhttp.NewClient(),
+			clock,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if runners.CounterRates(*counterRates) != runners.RawCounters {
+		for i, sink := range sinks {
+			rateSink, err := runners.NewRateSink(sink, runners.CounterRates(*counterRates), clock)
+			if err != nil {
+				return nil, err
+			}
+			sinks[i] = rateSink
+		}
+	}
+
+	return sinks, nil
+}
+
+func initializeLoggregatorV2Sink() (*runners.LoggregatorV2Sink, error) {
+	tlsConfig, err := loggregator.NewIngressTLSConfig(
+		*loggregatorCACertFilePath,
+		*loggregatorCertFilePath,
+		*loggregatorKeyFilePath,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := loggregator.NewIngressClient(tlsConfig, loggregator.WithAddr(*loggregatorAgentAddress))
+	if err != nil {
+		return nil, err
+	}
+
+	return runners.NewLoggregatorV2Sink(client, *jobName, strconv.FormatUint(uint64(*index), 10)), nil
+}
+
+func initializeMetronNotifier(
+	client *http.Client,
+	dial func(string) (*grpc.ClientConn, error),
+	discoverer runners.Discoverer,
+	api runners.EtcdAPI,
+	redirectPolicy instruments.RedirectPolicy,
+	intervals runners.ScrapeIntervals,
+	registry *instrumentation.Registry,
+	sinks []runners.Sink,
+	logger lager.Logger,
+) *runners.PeriodicMetronNotifier {
+	return runners.NewPeriodicMetronNotifier(
+		client,
+		discoverer,
+		registry,
+		sinks,
+		logger,
+		runners.NotifierConfig{
+			Dial:           dial,
+			API:            api,
+			RedirectPolicy: redirectPolicy,
+			Interval:       *reportInterval,
+			Intervals:      intervals,
+			Jitter:         *scrapeJitter,
+			Threshold:      *unreachableThreshold,
+			MaxBackoff:     *maxBackoff,
+		},
+	)
+}
+
+func initializeServer(
+	registry *instrumentation.Registry,
+	notifier *runners.PeriodicMetronNotifier,
+	intervals runners.ScrapeIntervals,
+	clock clock.Clock,
+	logger lager.Logger,
+) ifrit.Runner {
+	// metrics are considered stale once a scrape of the slowest instrument has
+	// been missed
+	maxAge := 2 * intervals.Longest(*reportInterval)
+
+	var handler http.Handler
+	handler = handlers.New(registry, *jobName, *index, notifier.HealthContexts, maxAge, clock, logger)
+
+	if *username != "" || *password != "" {
+		handler = handlers.NewBasicAuthHandler(*username, *password, handler)
+	}
+
+	return http_server.New(fmt.Sprintf(":%d", *port), handler)
 }
@@ -2,12 +2,15 @@ package fakes
 
 import (
 	"net/http"
+	"sync"
 
 	"code.cloudfoundry.org/cfhttp"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
 )
 
 type Getter struct {
+	lock sync.Mutex
+
 	GetCall struct {
 		CallCount int
 		Recieves  struct {
@@ -20,15 +23,30 @@ type Getter struct {
 }
 
 func (g *Getter) Get(address string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", address, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.Do(req)
+}
+
+// Do counts as a call to Get, so that requests made with a context are
+// recorded like the others.
+func (g *Getter) Do(req *http.Request) (*http.Response, error) {
+	g.lock.Lock()
 	g.GetCall.CallCount++
-	g.GetCall.Recieves.Address = address
-	if g.GetCall.Returns.Error != nil {
-		return nil, g.GetCall.Returns.Error
+	g.GetCall.Recieves.Address = req.URL.String()
+	err := g.GetCall.Returns.Error
+	g.lock.Unlock()
+
+	if err != nil {
+		return nil, err
 	}
 
 	client := cfhttp.NewClient()
 	client.CheckRedirect = func(*http.Request, []*http.Request) error {
 		return instruments.ErrRedirected
 	}
-	return client.Get(address)
+	return client.Do(req)
 }
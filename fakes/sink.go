@@ -0,0 +1,81 @@
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+type Sink struct {
+	lock sync.Mutex
+
+	SendCall struct {
+		CallCount int
+		Recieves  struct {
+			Contexts []instrumentation.Context
+		}
+		Returns struct {
+			Error error
+		}
+	}
+
+	FlushCall struct {
+		CallCount int
+		Returns   struct {
+			Error error
+		}
+	}
+
+	ForgetCall struct {
+		CallCount int
+		Recieves  struct {
+			Members []string
+		}
+	}
+}
+
+func (s *Sink) Send(context instrumentation.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.SendCall.CallCount++
+	s.SendCall.Recieves.Contexts = append(s.SendCall.Recieves.Contexts, context)
+	return s.SendCall.Returns.Error
+}
+
+func (s *Sink) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.FlushCall.CallCount++
+	return s.FlushCall.Returns.Error
+}
+
+func (s *Sink) Forget(member string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.ForgetCall.CallCount++
+	s.ForgetCall.Recieves.Members = append(s.ForgetCall.Recieves.Members, member)
+}
+
+func (s *Sink) SentContexts() []instrumentation.Context {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]instrumentation.Context{}, s.SendCall.Recieves.Contexts...)
+}
+
+func (s *Sink) FlushCallCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.FlushCall.CallCount
+}
+
+func (s *Sink) ForgottenMembers() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.ForgetCall.Recieves.Members...)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+const basicAuthRealm = "etcd-metrics-server"
+
+type BasicAuthHandler struct {
+	username string
+	password string
+	handler  http.Handler
+}
+
+func NewBasicAuthHandler(username, password string, handler http.Handler) *BasicAuthHandler {
+	return &BasicAuthHandler{
+		username: username,
+		password: password,
+		handler:  handler,
+	}
+}
+
+func (handler *BasicAuthHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	username, password, ok := req.BasicAuth()
+	if !ok || !handler.authorized(username, password) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+basicAuthRealm+`"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	handler.handler.ServeHTTP(w, req)
+}
+
+// authorized compares both credentials in constant time, and always compares
+// both, so that response timing does not reveal which one was wrong.
+func (handler *BasicAuthHandler) authorized(username, password string) bool {
+	usernameMatches := subtle.ConstantTimeCompare([]byte(username), []byte(handler.username))
+	passwordMatches := subtle.ConstantTimeCompare([]byte(password), []byte(handler.password))
+
+	return usernameMatches&passwordMatches == 1
+}
@@ -0,0 +1,76 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BasicAuthHandler", func() {
+	var (
+		handler  *handlers.BasicAuthHandler
+		recorder *httptest.ResponseRecorder
+		request  *http.Request
+		served   bool
+	)
+
+	BeforeEach(func() {
+		served = false
+		handler = handlers.NewBasicAuthHandler("admin", "secret", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			served = true
+			w.WriteHeader(http.StatusTeapot)
+		}))
+		recorder = httptest.NewRecorder()
+
+		var err error
+		request, err = http.NewRequest("GET", "/varz", nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		handler.ServeHTTP(recorder, request)
+	})
+
+	itRejectsTheRequest := func() {
+		It("responds with 401 and asks for credentials", func() {
+			Expect(served).To(BeFalse())
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			Expect(recorder.Header().Get("WWW-Authenticate")).To(Equal(`Basic realm="etcd-metrics-server"`))
+		})
+	}
+
+	Context("when the credentials are correct", func() {
+		BeforeEach(func() {
+			request.SetBasicAuth("admin", "secret")
+		})
+
+		It("serves the request", func() {
+			Expect(served).To(BeTrue())
+			Expect(recorder.Code).To(Equal(http.StatusTeapot))
+		})
+	})
+
+	Context("when no credentials are given", func() {
+		itRejectsTheRequest()
+	})
+
+	Context("when the username is wrong", func() {
+		BeforeEach(func() {
+			request.SetBasicAuth("root", "secret")
+		})
+
+		itRejectsTheRequest()
+	})
+
+	Context("when the password is wrong", func() {
+		BeforeEach(func() {
+			request.SetBasicAuth("admin", "guess")
+		})
+
+		itRejectsTheRequest()
+	})
+})
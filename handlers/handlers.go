@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+type registry interface {
+	contextSource
+	healthSource
+}
+
+func New(
+	registry registry,
+	jobName string,
+	index uint,
+	healthContexts func() map[string][]string,
+	maxAge time.Duration,
+	clock clock.Clock,
+	logger lager.Logger,
+) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", NewPrometheusHandler(registry, logger))
+	mux.Handle("/varz", NewVarzHandler(registry, jobName, index, clock, logger))
+	mux.Handle("/healthz", NewHealthzHandler(registry, healthContexts, maxAge, clock, logger))
+
+	return mux
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+type HealthzResponse struct {
+	Healthy bool     `json:"healthy"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+type healthSource interface {
+	Latest(member, name string) (instrumentation.Context, time.Time, bool)
+}
+
+type HealthzHandler struct {
+	source   healthSource
+	contexts func() map[string][]string
+	maxAge   time.Duration
+	clock    clock.Clock
+	logger   lager.Logger
+}
+
+// NewHealthzHandler reports healthy while every context returned by contexts,
+// keyed by member name, is fresh. The first context of each member is expected
+// to carry the HasLeader metric.
+func NewHealthzHandler(
+	source healthSource,
+	contexts func() map[string][]string,
+	maxAge time.Duration,
+	clock clock.Clock,
+	logger lager.Logger,
+) *HealthzHandler {
+	return &HealthzHandler{
+		source:   source,
+		contexts: contexts,
+		maxAge:   maxAge,
+		clock:    clock,
+		logger:   logger.Session("healthz-handler"),
+	}
+}
+
+func (handler *HealthzHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reasons := []string{}
+
+	contexts := handler.contexts()
+
+	members := make([]string, 0, len(contexts))
+	for member := range contexts {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	for _, member := range members {
+		for i, name := range contexts[member] {
+			context, ok := handler.check(member, name, &reasons)
+			if i == 0 && ok && !hasMetricValue(context, "HasLeader", 1) {
+				reasons = append(reasons, strings.TrimSpace("etcd member "+member)+" does not know the leader")
+			}
+		}
+	}
+
+	response := HealthzResponse{
+		Healthy: len(reasons) == 0,
+		Reasons: reasons,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if response.Healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		handler.logger.Error("failed-to-write-healthz", err)
+	}
+}
+
+// check verifies that the named context has been recorded recently and that
+// the instrument which emitted it managed to collect metrics.
+func (handler *HealthzHandler) check(member, name string, reasons *[]string) (instrumentation.Context, bool) {
+	context, recordedAt, found := handler.source.Latest(member, name)
+	if member != "" {
+		name = member + " " + name
+	}
+
+	if !found {
+		*reasons = append(*reasons, fmt.Sprintf("no %s metrics have been collected yet", name))
+		return context, false
+	}
+
+	age := handler.clock.Since(recordedAt)
+	if age > handler.maxAge {
+		*reasons = append(*reasons, fmt.Sprintf("%s metrics are stale: last collected %s ago", name, age))
+		return context, false
+	}
+
+	if len(context.Metrics) == 0 {
+		*reasons = append(*reasons, fmt.Sprintf("failed to collect %s metrics", name))
+		return context, false
+	}
+
+	return context, true
+}
+
+func hasMetricValue(context instrumentation.Context, name string, value int) bool {
+	for _, metric := range context.Metrics {
+		if metric.Name == name {
+			// instruments report numbers with differing types, e.g. int for the
+			// v2 stats and float64 for the v3 Prometheus endpoint
+			return fmt.Sprint(metric.Value) == fmt.Sprint(value)
+		}
+	}
+
+	return false
+}
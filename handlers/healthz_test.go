@@ -0,0 +1,214 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/handlers"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func staticContexts(names ...string) func() map[string][]string {
+	return func() map[string][]string {
+		return map[string][]string{"": names}
+	}
+}
+
+var _ = Describe("HealthzHandler", func() {
+	var (
+		registry  *instrumentation.Registry
+		fakeClock *fakeclock.FakeClock
+		handler   *handlers.HealthzHandler
+		recorder  *httptest.ResponseRecorder
+		response  handlers.HealthzResponse
+	)
+
+	serverContext := func(hasLeader int) instrumentation.Context {
+		return instrumentation.Context{
+			Name: "server",
+			Metrics: []instrumentation.Metric{
+				{Name: "IsLeader", Value: 0},
+				{Name: "HasLeader", Value: hasLeader},
+			},
+		}
+	}
+
+	storeContext := instrumentation.Context{
+		Name: "store",
+		Metrics: []instrumentation.Metric{
+			{Name: "RaftIndex", Value: uint64(10)},
+		},
+	}
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		registry = instrumentation.NewRegistry(fakeClock)
+		handler = handlers.NewHealthzHandler(registry, staticContexts("server", "store"), time.Minute, fakeClock, lagertest.NewTestLogger("test"))
+		recorder = httptest.NewRecorder()
+		response = handlers.HealthzResponse{}
+	})
+
+	JustBeforeEach(func() {
+		req, err := http.NewRequest("GET", "/healthz", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		handler.ServeHTTP(recorder, req)
+
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+		err = json.Unmarshal(recorder.Body.Bytes(), &response)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("when the server and store metrics are fresh and there is a leader", func() {
+		BeforeEach(func() {
+			registry.Record(serverContext(1))
+			registry.Record(storeContext)
+			fakeClock.Increment(30 * time.Second)
+		})
+
+		It("responds with 200", func() {
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(response).To(Equal(handlers.HealthzResponse{Healthy: true}))
+		})
+	})
+
+	Context("when nothing has been collected yet", func() {
+		It("responds with 503 and explains why", func() {
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(response.Healthy).To(BeFalse())
+			Expect(response.Reasons).To(ConsistOf(
+				"no server metrics have been collected yet",
+				"no store metrics have been collected yet",
+			))
+		})
+	})
+
+	Context("when the metrics are stale", func() {
+		BeforeEach(func() {
+			registry.Record(serverContext(1))
+			fakeClock.Increment(30 * time.Second)
+			registry.Record(storeContext)
+			fakeClock.Increment(31 * time.Second)
+		})
+
+		It("responds with 503 and explains why", func() {
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(response.Reasons).To(ConsistOf("server metrics are stale: last collected 1m1s ago"))
+		})
+	})
+
+	Context("when the last collection failed", func() {
+		BeforeEach(func() {
+			registry.Record(serverContext(1))
+			registry.Record(instrumentation.Context{Name: "store"})
+		})
+
+		It("responds with 503 and explains why", func() {
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(response.Reasons).To(ConsistOf("failed to collect store metrics"))
+		})
+	})
+
+	Context("when the member does not know the leader", func() {
+		BeforeEach(func() {
+			registry.Record(serverContext(0))
+			registry.Record(storeContext)
+		})
+
+		It("responds with 503 and explains why", func() {
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(response.Reasons).To(ConsistOf("etcd member does not know the leader"))
+		})
+	})
+
+	Context("when monitoring through the v3 metrics endpoint", func() {
+		BeforeEach(func() {
+			handler = handlers.NewHealthzHandler(registry, staticContexts("metrics"), time.Minute, fakeClock, lagertest.NewTestLogger("test"))
+		})
+
+		Context("and there is a leader", func() {
+			BeforeEach(func() {
+				registry.Record(instrumentation.Context{
+					Name:    "metrics",
+					Metrics: []instrumentation.Metric{{Name: "HasLeader", Value: float64(1)}},
+				})
+			})
+
+			It("responds with 200", func() {
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("and there is no leader", func() {
+			BeforeEach(func() {
+				registry.Record(instrumentation.Context{
+					Name:    "metrics",
+					Metrics: []instrumentation.Metric{{Name: "HasLeader", Value: float64(0)}},
+				})
+			})
+
+			It("responds with 503 and explains why", func() {
+				Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(response.Reasons).To(ConsistOf("etcd member does not know the leader"))
+			})
+		})
+	})
+
+	Context("when monitoring a whole cluster", func() {
+		BeforeEach(func() {
+			handler = handlers.NewHealthzHandler(registry, func() map[string][]string {
+				return map[string][]string{
+					"node1": {"server", "store"},
+					"node2": {"server", "store"},
+				}
+			}, time.Minute, fakeClock, lagertest.NewTestLogger("test"))
+
+			for _, member := range []string{"node1", "node2"} {
+				server := serverContext(1)
+				server.Member = member
+				store := storeContext
+				store.Member = member
+
+				registry.Record(server)
+				registry.Record(store)
+			}
+		})
+
+		Context("and every member is healthy", func() {
+			It("responds with 200", func() {
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("and a member does not know the leader", func() {
+			BeforeEach(func() {
+				server := serverContext(0)
+				server.Member = "node2"
+				registry.Record(server)
+			})
+
+			It("responds with 503 and names the member", func() {
+				Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(response.Reasons).To(ConsistOf("etcd member node2 does not know the leader"))
+			})
+		})
+
+		Context("and a member stopped reporting", func() {
+			BeforeEach(func() {
+				registry.Record(instrumentation.Context{Name: "store", Member: "node1"})
+			})
+
+			It("responds with 503 and names the member", func() {
+				Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(response.Reasons).To(ConsistOf("failed to collect node1 store metrics"))
+			})
+		})
+	})
+})
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+const (
+	prometheusNamespace   = "etcd"
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type contextSource interface {
+	Contexts() []instrumentation.Context
+}
+
+type PrometheusHandler struct {
+	source contextSource
+	logger lager.Logger
+}
+
+func NewPrometheusHandler(source contextSource, logger lager.Logger) *PrometheusHandler {
+	return &PrometheusHandler{
+		source: source,
+		logger: logger.Session("prometheus-handler"),
+	}
+}
+
+func (handler *PrometheusHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	families := map[string][]string{}
+	types := map[string]string{}
+	names := []string{}
+
+	for _, context := range handler.source.Contexts() {
+		for _, metric := range context.Metrics {
+			name := prometheusName(context.Name, metric.Name)
+			if _, found := families[name]; !found {
+				names = append(names, name)
+				types[name] = prometheusType(metric.Kind)
+			}
+
+			families[name] = append(families[name], prometheusSamples(name, metric)...)
+		}
+	}
+
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", prometheusContentType)
+
+	for _, name := range names {
+		_, err := fmt.Fprintf(w, "# TYPE %s %s\n%s\n", name, types[name], strings.Join(families[name], "\n"))
+		if err != nil {
+			handler.logger.Error("failed-to-write-metrics", err)
+			return
+		}
+	}
+}
+
+func prometheusType(kind instrumentation.MetricKind) string {
+	switch kind {
+	case instrumentation.Counter:
+		return "counter"
+	case instrumentation.Summary:
+		return "summary"
+	default:
+		return "gauge"
+	}
+}
+
+// prometheusSamples formats the metric as sample lines. Summaries are
+// exposed as their _sum and _count series.
+func prometheusSamples(name string, metric instrumentation.Metric) []string {
+	labels := prometheusLabels(metric.Tags)
+
+	if summary, ok := metric.Value.(instrumentation.SummaryValue); ok {
+		return []string{
+			fmt.Sprintf("%s_sum%s %v", name, labels, summary.Sum),
+			fmt.Sprintf("%s_count%s %v", name, labels, summary.Count),
+		}
+	}
+
+	return []string{fmt.Sprintf("%s%s %v", name, labels, metric.Value)}
+}
+
+func prometheusName(contextName, metricName string) string {
+	return strings.Join([]string{
+		prometheusNamespace,
+		snakeCase(contextName),
+		snakeCase(metricName),
+	}, "_")
+}
+
+func prometheusLabels(tags map[string]interface{}) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	labels := make([]string, 0, len(keys))
+	for _, key := range keys {
+		labels = append(labels, fmt.Sprintf(
+			`%s="%s"`,
+			snakeCase(key),
+			escapeLabelValue(fmt.Sprint(tags[key])),
+		))
+	}
+
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// snakeCase converts names such as "SendingBandwidthRate" into
+// "sending_bandwidth_rate", replacing anything that is not valid in a
+// Prometheus metric or label name with an underscore.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	result := make([]rune, 0, len(runes)+4)
+
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) && result[len(result)-1] != '_' {
+				result = append(result, '_')
+			}
+			result = append(result, unicode.ToLower(r))
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			result = append(result, r)
+		default:
+			result = append(result, '_')
+		}
+	}
+
+	return string(result)
+}
@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/handlers"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PrometheusHandler", func() {
+	var (
+		registry *instrumentation.Registry
+		handler  *handlers.PrometheusHandler
+		recorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		registry = instrumentation.NewRegistry(clock.NewClock())
+		handler = handlers.NewPrometheusHandler(registry, lagertest.NewTestLogger("test"))
+		recorder = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		req, err := http.NewRequest("GET", "/metrics", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		handler.ServeHTTP(recorder, req)
+	})
+
+	Context("when contexts have been recorded", func() {
+		BeforeEach(func() {
+			registry.Record(instrumentation.Context{
+				Name: "server",
+				Metrics: []instrumentation.Metric{
+					{Name: "IsLeader", Value: 1},
+					{Name: "SendingBandwidthRate", Value: 1211109.8},
+					{Name: "SentAppendRequests", Value: uint64(4321), Kind: instrumentation.Counter},
+				},
+			})
+
+			registry.Record(instrumentation.Context{
+				Name: "metrics",
+				Metrics: []instrumentation.Metric{
+					{
+						Name:  "WalFsyncDuration",
+						Value: instrumentation.SummaryValue{Count: 20102, Sum: 56.83011},
+						Kind:  instrumentation.Summary,
+					},
+				},
+			})
+
+			registry.Record(instrumentation.Context{
+				Name: "leader",
+				Metrics: []instrumentation.Metric{
+					{Name: "Followers", Value: 2},
+					{Name: "Latency", Value: 1.5, Tags: map[string]interface{}{"follower": "node1"}},
+					{Name: "Latency", Value: 2.0, Tags: map[string]interface{}{"follower": `node"2`}},
+				},
+			})
+		})
+
+		It("serves them in the prometheus text format", func() {
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+			Expect(recorder.Body.String()).To(Equal(`# TYPE etcd_leader_followers gauge
+etcd_leader_followers 2
+# TYPE etcd_leader_latency gauge
+etcd_leader_latency{follower="node1"} 1.5
+etcd_leader_latency{follower="node\"2"} 2
+# TYPE etcd_metrics_wal_fsync_duration summary
+etcd_metrics_wal_fsync_duration_sum 56.83011
+etcd_metrics_wal_fsync_duration_count 20102
+# TYPE etcd_server_is_leader gauge
+etcd_server_is_leader 1
+# TYPE etcd_server_sending_bandwidth_rate gauge
+etcd_server_sending_bandwidth_rate 1.2111098e+06
+# TYPE etcd_server_sent_append_requests counter
+etcd_server_sent_append_requests 4321
+`))
+		})
+	})
+
+	Context("when nothing has been recorded", func() {
+		It("serves an empty body", func() {
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+type VarzMessage struct {
+	Name            string                    `json:"name"`
+	Index           uint                      `json:"index"`
+	Start           time.Time                 `json:"start"`
+	Uptime          string                    `json:"uptime"`
+	UptimeInSeconds int64                     `json:"uptimeInSeconds"`
+	NumCPUS         int                       `json:"numCPUS"`
+	NumGoRoutines   int                       `json:"numGoRoutines"`
+	MemoryStats     MemoryStats               `json:"memoryStats"`
+	Contexts        []instrumentation.Context `json:"contexts"`
+}
+
+type MemoryStats struct {
+	BytesAllocatedHeap  uint64 `json:"numBytesAllocatedHeap"`
+	BytesAllocatedStack uint64 `json:"numBytesAllocatedStack"`
+	BytesAllocated      uint64 `json:"numBytesAllocated"`
+	NumMallocs          uint64 `json:"numMallocs"`
+	NumFrees            uint64 `json:"numFrees"`
+	LastGCPauseTimeNS   uint64 `json:"lastGCPauseTimeNS"`
+}
+
+type VarzHandler struct {
+	source    contextSource
+	jobName   string
+	index     uint
+	startTime time.Time
+	clock     clock.Clock
+	logger    lager.Logger
+}
+
+func NewVarzHandler(source contextSource, jobName string, index uint, clock clock.Clock, logger lager.Logger) *VarzHandler {
+	return &VarzHandler{
+		source:    source,
+		jobName:   jobName,
+		index:     index,
+		startTime: clock.Now(),
+		clock:     clock,
+		logger:    logger.Session("varz-handler"),
+	}
+}
+
+func (handler *VarzHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	uptime := handler.clock.Since(handler.startTime)
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	message := VarzMessage{
+		Name:            handler.jobName,
+		Index:           handler.index,
+		Start:           handler.startTime,
+		Uptime:          formatUptime(uptime),
+		UptimeInSeconds: int64(uptime / time.Second),
+		NumCPUS:         runtime.NumCPU(),
+		NumGoRoutines:   runtime.NumGoroutine(),
+		MemoryStats: MemoryStats{
+			BytesAllocatedHeap:  memStats.HeapAlloc,
+			BytesAllocatedStack: memStats.StackInuse,
+			BytesAllocated:      memStats.Alloc,
+			NumMallocs:          memStats.Mallocs,
+			NumFrees:            memStats.Frees,
+			LastGCPauseTimeNS:   memStats.PauseNs[(memStats.NumGC+255)%256],
+		},
+		Contexts: handler.source.Contexts(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(message)
+	if err != nil {
+		handler.logger.Error("failed-to-write-varz", err)
+	}
+}
+
+func formatUptime(uptime time.Duration) string {
+	seconds := int64(uptime / time.Second)
+
+	return fmt.Sprintf(
+		"%dd:%dh:%dm:%ds",
+		seconds/(24*60*60),
+		seconds/(60*60)%24,
+		seconds/60%60,
+		seconds%60,
+	)
+}
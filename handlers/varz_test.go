@@ -0,0 +1,102 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/handlers"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VarzHandler", func() {
+	var (
+		registry  *instrumentation.Registry
+		fakeClock *fakeclock.FakeClock
+		startTime time.Time
+		handler   *handlers.VarzHandler
+		recorder  *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		startTime = time.Date(2016, time.October, 1, 12, 0, 0, 0, time.UTC)
+		fakeClock = fakeclock.NewFakeClock(startTime)
+		registry = instrumentation.NewRegistry(fakeClock)
+		handler = handlers.NewVarzHandler(registry, "etcd-diego", 2, fakeClock, lagertest.NewTestLogger("test"))
+		recorder = httptest.NewRecorder()
+
+		registry.Record(instrumentation.Context{
+			Name: "leader",
+			Metrics: []instrumentation.Metric{
+				{Name: "Latency", Value: 1.5, Tags: map[string]interface{}{"follower": "node1"}},
+			},
+		})
+		registry.Record(instrumentation.Context{
+			Name: "server",
+			Metrics: []instrumentation.Metric{
+				{Name: "IsLeader", Value: 1},
+			},
+		})
+
+		fakeClock.Increment(26*time.Hour + 3*time.Minute + 4*time.Second)
+	})
+
+	JustBeforeEach(func() {
+		req, err := http.NewRequest("GET", "/varz", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		handler.ServeHTTP(recorder, req)
+	})
+
+	It("serves the process information and latest contexts as JSON", func() {
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var message handlers.VarzMessage
+		err := json.Unmarshal(recorder.Body.Bytes(), &message)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(message.Name).To(Equal("etcd-diego"))
+		Expect(message.Index).To(Equal(uint(2)))
+		Expect(message.Start).To(BeTemporally("==", startTime))
+		Expect(message.Uptime).To(Equal("1d:2h:3m:4s"))
+		Expect(message.UptimeInSeconds).To(Equal(int64(93784)))
+		Expect(message.NumCPUS).To(BeNumerically(">", 0))
+		Expect(message.NumGoRoutines).To(BeNumerically(">", 0))
+		Expect(message.MemoryStats.BytesAllocated).To(BeNumerically(">", 0))
+	})
+
+	It("uses the context and metric field names", func() {
+		var message map[string]interface{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &message)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(message["contexts"]).To(Equal([]interface{}{
+			map[string]interface{}{
+				"name": "leader",
+				"metrics": []interface{}{
+					map[string]interface{}{
+						"name":  "Latency",
+						"value": 1.5,
+						"tags":  map[string]interface{}{"follower": "node1"},
+					},
+				},
+			},
+			map[string]interface{}{
+				"name": "server",
+				"metrics": []interface{}{
+					map[string]interface{}{
+						"name":  "IsLeader",
+						"value": float64(1),
+					},
+				},
+			},
+		}))
+	})
+})
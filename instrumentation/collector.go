@@ -0,0 +1,85 @@
+package instrumentation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Collector is an instrument that gives up when ctx is done and tells the
+// caller why it failed rather than only logging it.
+type Collector interface {
+	Collect(ctx context.Context) (Context, error)
+}
+
+// CollectError tells which step of collecting a context failed, e.g. fetching
+// or parsing the stats.
+type CollectError struct {
+	Context string
+	Op      string
+	Err     error
+}
+
+func (err *CollectError) Error() string {
+	return fmt.Sprintf("failed to %s %s metrics: %s", err.Op, err.Context, err.Err)
+}
+
+func (err *CollectError) Unwrap() error {
+	return err.Err
+}
+
+var (
+	// ErrStillEmitting is returned when an instrument is collected again before
+	// its previous Emit has returned.
+	ErrStillEmitting = errors.New("the previous emit has not returned yet")
+
+	// ErrNoMetrics is returned when Emit failed, which it signals by leaving the
+	// metrics nil rather than empty. The instrument has already logged why.
+	ErrNoMetrics = errors.New("the instrument failed to emit any metrics")
+)
+
+type emitCollector struct {
+	name       string
+	instrument Instrumentable
+	busy       chan struct{}
+}
+
+// NewEmitCollector adapts an Instrumentable, which logs its own errors, to a
+// Collector. Emit runs in the background, and only once at a time, so that the
+// caller can stop waiting when ctx is done. A ContextInstrumentable is given
+// ctx, so that its requests are abandoned too.
+func NewEmitCollector(name string, instrument Instrumentable) Collector {
+	return &emitCollector{
+		name:       name,
+		instrument: instrument,
+		busy:       make(chan struct{}, 1),
+	}
+}
+
+func (collector *emitCollector) Collect(ctx context.Context) (Context, error) {
+	select {
+	case collector.busy <- struct{}{}:
+	default:
+		return Context{Name: collector.name}, &CollectError{Context: collector.name, Op: "emit", Err: ErrStillEmitting}
+	}
+
+	emitted := make(chan Context, 1)
+	go func() {
+		defer func() { <-collector.busy }()
+		if instrument, ok := collector.instrument.(ContextInstrumentable); ok {
+			emitted <- instrument.EmitContext(ctx)
+			return
+		}
+		emitted <- collector.instrument.Emit()
+	}()
+
+	select {
+	case context := <-emitted:
+		if context.Metrics == nil {
+			return context, &CollectError{Context: collector.name, Op: "emit", Err: ErrNoMetrics}
+		}
+		return context, nil
+	case <-ctx.Done():
+		return Context{Name: collector.name}, &CollectError{Context: collector.name, Op: "emit", Err: ctx.Err()}
+	}
+}
@@ -0,0 +1,118 @@
+package instrumentation_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type blockingInstrument struct {
+	unblock chan struct{}
+}
+
+func (instrument blockingInstrument) Emit() instrumentation.Context {
+	<-instrument.unblock
+	return instrumentation.Context{Name: "server", Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1}}}
+}
+
+// contextInstrument emits once the context it was given is done.
+type contextInstrument struct{}
+
+func (instrument contextInstrument) Emit() instrumentation.Context {
+	select {}
+}
+
+func (instrument contextInstrument) EmitContext(ctx context.Context) instrumentation.Context {
+	<-ctx.Done()
+	return instrumentation.Context{Name: "server"}
+}
+
+var _ = Describe("EmitCollector", func() {
+	var (
+		instrument blockingInstrument
+		collector  instrumentation.Collector
+	)
+
+	BeforeEach(func() {
+		instrument = blockingInstrument{unblock: make(chan struct{})}
+		collector = instrumentation.NewEmitCollector("server", instrument)
+	})
+
+	It("returns what the instrument emitted", func() {
+		close(instrument.unblock)
+
+		collected, err := collector.Collect(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(collected).To(Equal(instrumentation.Context{Name: "server", Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1}}}))
+	})
+
+	Context("when the context is done before Emit returns", func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			once   sync.Once
+		)
+
+		release := func() {
+			once.Do(func() { close(instrument.unblock) })
+		}
+
+		BeforeEach(func() {
+			once = sync.Once{}
+			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+		})
+
+		AfterEach(func() {
+			cancel()
+			release()
+		})
+
+		It("returns an empty context with the context's error", func() {
+			collected, err := collector.Collect(ctx)
+			Expect(collected).To(Equal(instrumentation.Context{Name: "server"}))
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+			Expect(err).To(MatchError("failed to emit server metrics: context deadline exceeded"))
+		})
+
+		It("does not run Emit again until it has returned", func() {
+			collector.Collect(ctx)
+
+			_, err := collector.Collect(context.Background())
+			Expect(errors.Is(err, instrumentation.ErrStillEmitting)).To(BeTrue())
+
+			release()
+			Eventually(func() error {
+				_, err := collector.Collect(context.Background())
+				return err
+			}).Should(Succeed())
+		})
+	})
+
+	Context("when the instrument takes a context", func() {
+		BeforeEach(func() {
+			collector = instrumentation.NewEmitCollector("server", contextInstrument{})
+		})
+
+		It("gives the instrument the context, so that it stops emitting when it is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			_, err := collector.Collect(ctx)
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+
+			Eventually(func() error {
+				cancelled, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				_, err := collector.Collect(cancelled)
+				return err
+			}).ShouldNot(MatchError(ContainSubstring(instrumentation.ErrStillEmitting.Error())))
+		})
+	})
+})
@@ -2,5 +2,6 @@ package instrumentation
 
 type Context struct {
 	Name    string   `json:"name"`
+	Member  string   `json:"member,omitempty"`
 	Metrics []Metric `json:"metrics"`
 }
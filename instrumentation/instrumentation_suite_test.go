@@ -0,0 +1,13 @@
+package instrumentation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestInstrumentation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Instrumentation Suite")
+}
@@ -1,5 +1,17 @@
 package instrumentation
 
+import "context"
+
+// Instrumentable is an instrument that logs its own errors. Emit leaves the
+// metrics of the context nil when it failed, and empty when there is nothing
+// to report.
 type Instrumentable interface {
 	Emit() Context
 }
+
+// ContextInstrumentable is an Instrumentable whose requests are abandoned once
+// ctx is done.
+type ContextInstrumentable interface {
+	Instrumentable
+	EmitContext(ctx context.Context) Context
+}
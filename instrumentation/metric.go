@@ -1,7 +1,34 @@
 package instrumentation
 
+// MetricKind tells sinks how the value of a metric behaves over time. Metrics
+// without a kind are gauges.
+type MetricKind string
+
+const (
+	Gauge   MetricKind = "gauge"
+	Counter MetricKind = "counter"
+	Summary MetricKind = "summary"
+)
+
+const (
+	BytesUnit             = "B"
+	SecondsUnit           = "s"
+	MillisecondsUnit      = "ms"
+	BytesPerSecondUnit    = "B/s"
+	RequestsPerSecondUnit = "Req/s"
+)
+
 type Metric struct {
 	Name  string                 `json:"name"`
 	Value interface{}            `json:"value"`
 	Tags  map[string]interface{} `json:"tags,omitempty"`
+	Kind  MetricKind             `json:"kind,omitempty"`
+	Unit  string                 `json:"unit,omitempty"`
+}
+
+// SummaryValue is the value of a Summary metric: the number of observations
+// and their sum, e.g. of the durations of all WAL fsyncs.
+type SummaryValue struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
 }
@@ -0,0 +1,89 @@
+package instrumentation
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+type Registry struct {
+	clock clock.Clock
+
+	lock       sync.RWMutex
+	keys       []registryKey
+	contexts   map[registryKey]Context
+	recordedAt map[registryKey]time.Time
+}
+
+// registryKey identifies a context; contexts of the same name are kept apart
+// for each member when monitoring a whole cluster.
+type registryKey struct {
+	member string
+	name   string
+}
+
+func NewRegistry(clock clock.Clock) *Registry {
+	return &Registry{
+		clock:      clock,
+		contexts:   map[registryKey]Context{},
+		recordedAt: map[registryKey]time.Time{},
+	}
+}
+
+func (registry *Registry) Record(context Context) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	key := registryKey{member: context.Member, name: context.Name}
+
+	if _, found := registry.contexts[key]; !found {
+		registry.keys = append(registry.keys, key)
+	}
+
+	registry.contexts[key] = context
+	registry.recordedAt[key] = registry.clock.Now()
+}
+
+func (registry *Registry) Contexts() []Context {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	contexts := make([]Context, 0, len(registry.keys))
+	for _, key := range registry.keys {
+		contexts = append(contexts, registry.contexts[key])
+	}
+
+	return contexts
+}
+
+// Latest returns the most recently recorded context with the given name for
+// the member and the time at which it was recorded. The member is empty when
+// a single etcd member is monitored.
+func (registry *Registry) Latest(member, name string) (Context, time.Time, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	key := registryKey{member: member, name: name}
+	context, found := registry.contexts[key]
+	return context, registry.recordedAt[key], found
+}
+
+// Forget drops every context recorded for the member, e.g. once it has left
+// the cluster.
+func (registry *Registry) Forget(member string) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	keys := registry.keys[:0]
+	for _, key := range registry.keys {
+		if key.member == member {
+			delete(registry.contexts, key)
+			delete(registry.recordedAt, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	registry.keys = keys
+}
@@ -0,0 +1,89 @@
+package instrumentation_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var (
+		registry  *instrumentation.Registry
+		fakeClock *fakeclock.FakeClock
+	)
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1000, 0))
+		registry = instrumentation.NewRegistry(fakeClock)
+	})
+
+	It("returns the latest context for each name in the order they were first recorded", func() {
+		registry.Record(instrumentation.Context{Name: "server", Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 0}}})
+		registry.Record(instrumentation.Context{Name: "store"})
+		registry.Record(instrumentation.Context{Name: "server", Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1}}})
+
+		Expect(registry.Contexts()).To(Equal([]instrumentation.Context{
+			{Name: "server", Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1}}},
+			{Name: "store"},
+		}))
+	})
+
+	It("keeps the contexts of each member apart", func() {
+		registry.Record(instrumentation.Context{Name: "server", Member: "node1"})
+		registry.Record(instrumentation.Context{Name: "server", Member: "node2"})
+
+		Expect(registry.Contexts()).To(Equal([]instrumentation.Context{
+			{Name: "server", Member: "node1"},
+			{Name: "server", Member: "node2"},
+		}))
+
+		_, _, found := registry.Latest("node2", "server")
+		Expect(found).To(BeTrue())
+
+		_, _, found = registry.Latest("", "server")
+		Expect(found).To(BeFalse())
+	})
+
+	It("returns no contexts when nothing has been recorded", func() {
+		Expect(registry.Contexts()).To(BeEmpty())
+	})
+
+	Describe("Latest", func() {
+		It("returns the latest context with the time it was recorded", func() {
+			registry.Record(instrumentation.Context{Name: "server"})
+			fakeClock.Increment(time.Minute)
+			registry.Record(instrumentation.Context{Name: "server", Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1}}})
+
+			context, recordedAt, found := registry.Latest("", "server")
+			Expect(found).To(BeTrue())
+			Expect(context.Metrics).To(HaveLen(1))
+			Expect(recordedAt).To(Equal(time.Unix(1060, 0)))
+		})
+
+		It("reports when no context with the name has been recorded", func() {
+			_, _, found := registry.Latest("", "store")
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("Forget", func() {
+		It("drops the contexts of the member", func() {
+			registry.Record(instrumentation.Context{Name: "server", Member: "node1"})
+			registry.Record(instrumentation.Context{Name: "store", Member: "node2"})
+			registry.Record(instrumentation.Context{Name: "store", Member: "node1"})
+
+			registry.Forget("node1")
+
+			Expect(registry.Contexts()).To(Equal([]instrumentation.Context{
+				{Name: "store", Member: "node2"},
+			}))
+
+			_, _, found := registry.Latest("node1", "server")
+			Expect(found).To(BeFalse())
+		})
+	})
+})
@@ -1,39 +1,95 @@
 package instruments
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
 )
 
+// RedirectPolicy decides what the Leader instrument emits on a follower,
+// which redirects requests for the leader stats to the leader.
+type RedirectPolicy string
+
+const (
+	// SkipOnFollower emits nothing.
+	SkipOnFollower RedirectPolicy = "skip"
+	// FollowToLeader emits the stats of the leader, tagged with source=leader.
+	FollowToLeader RedirectPolicy = "follow"
+	// ZeroOnFollower emits Followers=0.
+	ZeroOnFollower RedirectPolicy = "zero"
+)
+
 type Leader struct {
-	statsEndpoint string
-	logger        lager.Logger
-	getter        getter
+	statsEndpoint  string
+	redirectPolicy RedirectPolicy
+	logger         lager.Logger
+	getter         getter
+
+	// previousCounts are the RPC counts of each follower at the last scrape,
+	// used to derive the failure ratio over the interval since
+	previousCounts map[string]rpcCounts
+}
+
+type rpcCounts struct {
+	fail    uint64
+	success uint64
 }
 
 var ErrRedirected = errors.New("redirected to leader")
 
-func NewLeader(getter getter, etcdAddr string, logger lager.Logger) *Leader {
+func NewLeader(getter getter, etcdAddr string, redirectPolicy RedirectPolicy, logger lager.Logger) *Leader {
 	return &Leader{
-		statsEndpoint: fmt.Sprintf("%s/v2/stats/leader", etcdAddr),
-		logger:        logger,
-		getter:        getter,
+		statsEndpoint:  fmt.Sprintf("%s/v2/stats/leader", etcdAddr),
+		redirectPolicy: redirectPolicy,
+		logger:         logger,
+		getter:         getter,
+		previousCounts: map[string]rpcCounts{},
 	}
 }
 
 func (leader *Leader) Emit() instrumentation.Context {
+	return leader.EmitContext(context.Background())
+}
+
+// EmitContext is Emit with requests that are abandoned once ctx is done.
+func (leader *Leader) EmitContext(ctx context.Context) instrumentation.Context {
 	context := instrumentation.Context{
-		Name:    "leader",
-		Metrics: []instrumentation.Metric{},
+		Name: "leader",
 	}
 
-	var stats RaftFollowersStats
+	var tags map[string]interface{}
+
+	resp, err := Get(ctx, leader.getter, leader.statsEndpoint)
+	if isRedirect(err) {
+		switch leader.redirectPolicy {
+		case FollowToLeader:
+			resp, err = leader.followRedirect(ctx, resp)
+			tags = map[string]interface{}{"source": "leader"}
+
+		case ZeroOnFollower:
+			context.Metrics = []instrumentation.Metric{
+				{
+					Name:  "Followers",
+					Value: 0,
+				},
+			}
+			return context
+
+		default:
+			// followers have nothing to report, which is not a failure
+			leader.logger.Debug("skipping-leader-stats-on-follower")
+			context.Metrics = []instrumentation.Metric{}
+			return context
+		}
+	}
 
-	resp, err := leader.getter.Get(leader.statsEndpoint)
 	if err != nil {
 		leader.logger.Error("failed-to-collect-leader-stats", err)
 		return context
@@ -41,6 +97,7 @@ func (leader *Leader) Emit() instrumentation.Context {
 
 	defer resp.Body.Close()
 
+	var stats RaftFollowersStats
 	err = json.NewDecoder(resp.Body).Decode(&stats)
 	if err != nil {
 		leader.logger.Error("failed-to-unmarshal-leader-stats", err)
@@ -51,18 +108,126 @@ func (leader *Leader) Emit() instrumentation.Context {
 		{
 			Name:  "Followers",
 			Value: len(stats.Followers),
+			Tags:  withTags(tags, nil),
 		},
 	}
 
-	for name, follower := range stats.Followers {
-		context.Metrics = append(context.Metrics, instrumentation.Metric{
-			Name:  "Latency",
-			Value: follower.Latency.Current,
-			Tags: map[string]interface{}{
-				"follower": name,
-			},
-		})
+	names := make([]string, 0, len(stats.Followers))
+	for name := range stats.Followers {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+
+	counts := map[string]rpcCounts{}
+
+	for _, name := range names {
+		follower := stats.Followers[name]
+		followerTags := withTags(tags, map[string]interface{}{"follower": name})
+
+		metric := func(metricName string, value interface{}) instrumentation.Metric {
+			return instrumentation.Metric{
+				Name:  metricName,
+				Value: value,
+				Tags:  followerTags,
+			}
+		}
+
+		latency := func(metricName string, value float64) instrumentation.Metric {
+			m := metric(metricName, value)
+			m.Unit = instrumentation.MillisecondsUnit
+			return m
+		}
+
+		counter := func(metricName string, value uint64) instrumentation.Metric {
+			m := metric(metricName, value)
+			m.Kind = instrumentation.Counter
+			return m
+		}
+
+		context.Metrics = append(context.Metrics,
+			latency("Latency", follower.Latency.Current),
+			latency("LatencyAverage", follower.Latency.Average),
+			latency("LatencyStandardDeviation", follower.Latency.StandardDeviation),
+			latency("LatencyMinimum", follower.Latency.Minimum),
+			latency("LatencyMaximum", follower.Latency.Maximum),
+			counter("FailCount", follower.Counts.Fail),
+			counter("SuccessCount", follower.Counts.Success),
+		)
+
+		current := rpcCounts{fail: follower.Counts.Fail, success: follower.Counts.Success}
+		counts[name] = current
+
+		if previous, found := leader.previousCounts[name]; found {
+			if ratio, ok := failureRatio(previous, current); ok {
+				context.Metrics = append(context.Metrics, metric("FailureRatio", ratio))
+			}
+		}
+	}
+
+	leader.previousCounts = counts
 
 	return context
 }
+
+// failureRatio is the share of RPCs to a follower that failed between two
+// scrapes. There is none when no RPCs were sent or when the counts were reset,
+// e.g. because another member became leader.
+func failureRatio(previous, current rpcCounts) (float64, bool) {
+	if current.fail < previous.fail || current.success < previous.success {
+		return 0, false
+	}
+
+	failed := current.fail - previous.fail
+	total := failed + current.success - previous.success
+	if total == 0 {
+		return 0, false
+	}
+
+	return float64(failed) / float64(total), true
+}
+
+// followRedirect requests the leader stats from the leader the follower's
+// response redirected to.
+func (leader *Leader) followRedirect(ctx context.Context, resp *http.Response) (*http.Response, error) {
+	if resp == nil || resp.Header.Get("Location") == "" {
+		return nil, ErrRedirected
+	}
+
+	base := &url.URL{}
+	if resp.Request != nil {
+		base = resp.Request.URL
+	}
+
+	location, err := base.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return nil, err
+	}
+
+	leader.logger.Debug("following-redirect-to-leader", lager.Data{"location": location.String()})
+
+	return Get(ctx, leader.getter, location.String())
+}
+
+func isRedirect(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	return err == ErrRedirected
+}
+
+func withTags(tags, extra map[string]interface{}) map[string]interface{} {
+	if len(tags) == 0 && len(extra) == 0 {
+		return nil
+	}
+
+	merged := map[string]interface{}{}
+	for key, value := range tags {
+		merged[key] = value
+	}
+	for key, value := range extra {
+		merged[key] = value
+	}
+
+	return merged
+}
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"time"
 
+	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/fakes"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
@@ -71,7 +72,7 @@ var _ = Describe("Leader Instrumentation", func() {
 					w.WriteHeader(http.StatusTeapot)
 				}))
 
-				leader = instruments.NewLeader(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+				leader = instruments.NewLeader(fakeGetter, etcdServer.URL, instruments.SkipOnFollower, lagertest.NewTestLogger("test"))
 			})
 
 			It("should return them", func() {
@@ -87,6 +88,7 @@ var _ = Describe("Leader Instrumentation", func() {
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "Latency",
 					Value: 1.0,
+					Unit:  instrumentation.MillisecondsUnit,
 					Tags: map[string]interface{}{
 						"follower": "node1",
 					},
@@ -95,6 +97,7 @@ var _ = Describe("Leader Instrumentation", func() {
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "Latency",
 					Value: 2.0,
+					Unit:  instrumentation.MillisecondsUnit,
 					Tags: map[string]interface{}{
 						"follower": "node2",
 					},
@@ -102,29 +105,150 @@ var _ = Describe("Leader Instrumentation", func() {
 
 				Expect(fakeGetter.GetCall.CallCount).To(Equal(1))
 			})
+
+			It("should return the full latency stats and RPC counts of each follower", func() {
+				context := leader.Emit()
+
+				node1 := map[string]interface{}{"follower": "node1"}
+				Expect(context.Metrics).To(ContainElement(instrumentation.Metric{Name: "LatencyAverage", Value: 0.37073788356538245, Tags: node1, Unit: instrumentation.MillisecondsUnit}))
+				Expect(context.Metrics).To(ContainElement(instrumentation.Metric{Name: "LatencyStandardDeviation", Value: 0.41350537505117785, Tags: node1, Unit: instrumentation.MillisecondsUnit}))
+				Expect(context.Metrics).To(ContainElement(instrumentation.Metric{Name: "LatencyMinimum", Value: 0.124347, Tags: node1, Unit: instrumentation.MillisecondsUnit}))
+				Expect(context.Metrics).To(ContainElement(instrumentation.Metric{Name: "LatencyMaximum", Value: 65.038854, Tags: node1, Unit: instrumentation.MillisecondsUnit}))
+				Expect(context.Metrics).To(ContainElement(instrumentation.Metric{Name: "FailCount", Value: uint64(0), Tags: node1, Kind: instrumentation.Counter}))
+				Expect(context.Metrics).To(ContainElement(instrumentation.Metric{Name: "SuccessCount", Value: uint64(277031), Tags: node1, Kind: instrumentation.Counter}))
+			})
+		})
+
+		Context("when the leader is scraped repeatedly", func() {
+			var counts []string
+
+			failureRatios := func(context instrumentation.Context) []float64 {
+				ratios := []float64{}
+				for _, metric := range context.Metrics {
+					if metric.Name == "FailureRatio" {
+						ratios = append(ratios, metric.Value.(float64))
+					}
+				}
+				return ratios
+			}
+
+			BeforeEach(func() {
+				counts = []string{
+					`{"fail": 10, "success": 1000}`,
+					`{"fail": 15, "success": 1015}`,
+					`{"fail": 15, "success": 1015}`,
+					`{"fail": 1, "success": 3}`,
+					`{"fail": 2, "success": 6}`,
+				}
+
+				etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.Write([]byte(`{"followers": {"node1": {"counts": ` + counts[0] + `}}, "leader": "node0"}`))
+					counts = counts[1:]
+				}))
+
+				leader = instruments.NewLeader(fakeGetter, etcdServer.URL, instruments.SkipOnFollower, lagertest.NewTestLogger("test"))
+			})
+
+			It("derives the failure ratio from the counts since the last scrape", func() {
+				By("not reporting a ratio for the first scrape")
+				Expect(failureRatios(leader.Emit())).To(BeEmpty())
+
+				By("reporting the share of RPCs that failed since")
+				Expect(failureRatios(leader.Emit())).To(Equal([]float64{0.25}))
+
+				By("not reporting a ratio when no RPCs were sent")
+				Expect(failureRatios(leader.Emit())).To(BeEmpty())
+
+				By("not reporting a ratio when the counts were reset")
+				Expect(failureRatios(leader.Emit())).To(BeEmpty())
+				Expect(failureRatios(leader.Emit())).To(Equal([]float64{0.25}))
+			})
 		})
 
 		Context("when the etcd server is a follower", func() {
+			var (
+				leaderServer *httptest.Server
+				logger       *lagertest.TestLogger
+			)
+
+			newLeader := func(policy instruments.RedirectPolicy) *instruments.Leader {
+				return instruments.NewLeader(fakeGetter, etcdServer.URL, policy, logger)
+			}
+
 			BeforeEach(func() {
+				logger = lagertest.NewTestLogger("test")
+
+				leaderServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					if req.URL.Path == "/v2/stats/leader" && req.Method == "GET" {
+						w.Write([]byte(`{"followers": {"node1": {"latency": {"current": 1.0}}}, "leader": "node0"}`))
+						return
+					}
+					w.WriteHeader(http.StatusTeapot)
+				}))
+
 				etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 					switch req.URL.Path {
 					case "/v2/stats/leader":
 						if req.Method == "GET" {
-							w.Header().Set("Location", "http://some/other/leader")
+							w.Header().Set("Location", leaderServer.URL+"/v2/stats/leader")
 							w.WriteHeader(http.StatusFound)
 							return
 						}
 					}
 					w.WriteHeader(http.StatusTeapot)
 				}))
+			})
 
-				leader = instruments.NewLeader(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+			AfterEach(func() {
+				leaderServer.Close()
 			})
 
-			It("does not report any metrics", func() {
-				context := leader.Emit()
-				Expect(context.Metrics).ShouldNot(BeNil())
-				Expect(context.Metrics).Should(BeEmpty())
+			Context("when skipping followers", func() {
+				It("does not report any metrics", func() {
+					context := newLeader(instruments.SkipOnFollower).Emit()
+					Expect(context.Metrics).ShouldNot(BeNil())
+					Expect(context.Metrics).Should(BeEmpty())
+				})
+
+				It("does not log an error", func() {
+					newLeader(instruments.SkipOnFollower).Emit()
+					Expect(logger.LogMessages()).To(Equal([]string{"test.skipping-leader-stats-on-follower"}))
+					Expect(logger.Logs()[0].LogLevel).To(Equal(lager.DEBUG))
+				})
+			})
+
+			Context("when following the redirect", func() {
+				It("reports the leader's stats tagged with their source", func() {
+					context := newLeader(instruments.FollowToLeader).Emit()
+
+					node1 := map[string]interface{}{"source": "leader", "follower": "node1"}
+					Expect(context.Metrics).To(ConsistOf(
+						instrumentation.Metric{
+							Name:  "Followers",
+							Value: 1,
+							Tags:  map[string]interface{}{"source": "leader"},
+						},
+						instrumentation.Metric{Name: "Latency", Value: 1.0, Tags: node1, Unit: instrumentation.MillisecondsUnit},
+						instrumentation.Metric{Name: "LatencyAverage", Value: 0.0, Tags: node1, Unit: instrumentation.MillisecondsUnit},
+						instrumentation.Metric{Name: "LatencyStandardDeviation", Value: 0.0, Tags: node1, Unit: instrumentation.MillisecondsUnit},
+						instrumentation.Metric{Name: "LatencyMinimum", Value: 0.0, Tags: node1, Unit: instrumentation.MillisecondsUnit},
+						instrumentation.Metric{Name: "LatencyMaximum", Value: 0.0, Tags: node1, Unit: instrumentation.MillisecondsUnit},
+						instrumentation.Metric{Name: "FailCount", Value: uint64(0), Tags: node1, Kind: instrumentation.Counter},
+						instrumentation.Metric{Name: "SuccessCount", Value: uint64(0), Tags: node1, Kind: instrumentation.Counter},
+					))
+
+					Expect(fakeGetter.GetCall.CallCount).To(Equal(2))
+					Expect(fakeGetter.GetCall.Recieves.Address).To(Equal(leaderServer.URL + "/v2/stats/leader"))
+				})
+			})
+
+			Context("when reporting zero followers", func() {
+				It("reports that the member has no followers", func() {
+					context := newLeader(instruments.ZeroOnFollower).Emit()
+					Expect(context.Metrics).To(Equal([]instrumentation.Metric{
+						{Name: "Followers", Value: 0},
+					}))
+				})
 			})
 		})
 
@@ -141,7 +265,7 @@ var _ = Describe("Leader Instrumentation", func() {
 					w.WriteHeader(http.StatusTeapot)
 				}))
 
-				leader = instruments.NewLeader(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+				leader = instruments.NewLeader(fakeGetter, etcdServer.URL, instruments.SkipOnFollower, lagertest.NewTestLogger("test"))
 			})
 
 			It("does not report any metrics", func() {
@@ -164,7 +288,7 @@ var _ = Describe("Leader Instrumentation", func() {
 					w.WriteHeader(http.StatusTeapot)
 				}))
 
-				leader = instruments.NewLeader(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+				leader = instruments.NewLeader(fakeGetter, etcdServer.URL, instruments.SkipOnFollower, lagertest.NewTestLogger("test"))
 			})
 
 			It("does not report any metrics", func() {
@@ -177,7 +301,7 @@ var _ = Describe("Leader Instrumentation", func() {
 	Context("when the metrics fail to fetch", func() {
 		BeforeEach(func() {
 			etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
-			leader = instruments.NewLeader(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+			leader = instruments.NewLeader(fakeGetter, etcdServer.URL, instruments.SkipOnFollower, lagertest.NewTestLogger("test"))
 		})
 
 		It("should not return them", func() {
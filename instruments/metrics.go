@@ -0,0 +1,136 @@
+package instruments
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// metricsSeries maps the etcd v3 Prometheus series we re-emit to the metric
+// names used by the rest of the server. Labels listed in tags are carried over
+// as metric tags under the given tag name. Histograms are re-emitted as
+// summaries of their count and sum.
+var metricsSeries = map[string]struct {
+	name string
+	kind instrumentation.MetricKind
+	unit string
+	tags map[string]string
+}{
+	"etcd_server_has_leader":                    {name: "HasLeader"},
+	"etcd_server_is_leader":                     {name: "IsLeader"},
+	"etcd_server_leader_changes_seen_total":     {name: "LeaderChanges", kind: instrumentation.Counter},
+	"etcd_server_proposals_committed_total":     {name: "ProposalsCommitted", kind: instrumentation.Counter},
+	"etcd_server_proposals_applied_total":       {name: "ProposalsApplied", kind: instrumentation.Counter},
+	"etcd_server_proposals_pending":             {name: "ProposalsPending"},
+	"etcd_server_proposals_failed_total":        {name: "ProposalsFailed", kind: instrumentation.Counter},
+	"etcd_mvcc_db_total_size_in_bytes":          {name: "DbTotalSize", unit: instrumentation.BytesUnit},
+	"etcd_mvcc_db_total_size_in_use_in_bytes":   {name: "DbTotalSizeInUse", unit: instrumentation.BytesUnit},
+	"etcd_debugging_mvcc_keys_total":            {name: "KeysTotal"},
+	"etcd_mvcc_put_total":                       {name: "PutTotal", kind: instrumentation.Counter},
+	"etcd_mvcc_delete_total":                    {name: "DeleteTotal", kind: instrumentation.Counter},
+	"etcd_mvcc_range_total":                     {name: "RangeTotal", kind: instrumentation.Counter},
+	"etcd_network_peer_sent_bytes_total":        {name: "PeerSentBytes", kind: instrumentation.Counter, unit: instrumentation.BytesUnit, tags: map[string]string{"To": "to"}},
+	"etcd_network_peer_received_bytes_total":    {name: "PeerReceivedBytes", kind: instrumentation.Counter, unit: instrumentation.BytesUnit, tags: map[string]string{"From": "from"}},
+	"etcd_disk_wal_fsync_duration_seconds":      {name: "WalFsyncDuration", kind: instrumentation.Summary, unit: instrumentation.SecondsUnit},
+	"etcd_disk_backend_commit_duration_seconds": {name: "BackendCommitDuration", kind: instrumentation.Summary, unit: instrumentation.SecondsUnit},
+}
+
+// Metrics scrapes the Prometheus endpoint served by etcd v3 members, which no
+// longer serve the v2 stats endpoints.
+type Metrics struct {
+	metricsEndpoint string
+	getter          getter
+}
+
+func NewMetrics(getter getter, etcdAddr string) *Metrics {
+	return &Metrics{
+		metricsEndpoint: fmt.Sprintf("%s/metrics", etcdAddr),
+		getter:          getter,
+	}
+}
+
+func (m *Metrics) Collect(ctx context.Context) (instrumentation.Context, error) {
+	context := instrumentation.Context{
+		Name: "metrics",
+	}
+
+	resp, err := Get(ctx, m.getter, m.metricsEndpoint)
+	if err != nil {
+		return context, &instrumentation.CollectError{Context: context.Name, Op: "fetch", Err: err}
+	}
+
+	defer resp.Body.Close()
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return context, &instrumentation.CollectError{Context: context.Name, Op: "parse", Err: err}
+	}
+
+	seriesNames := make([]string, 0, len(families))
+	for seriesName := range families {
+		seriesNames = append(seriesNames, seriesName)
+	}
+	sort.Strings(seriesNames)
+
+	for _, seriesName := range seriesNames {
+		series, found := metricsSeries[seriesName]
+		if !found {
+			continue
+		}
+
+		for _, sample := range families[seriesName].GetMetric() {
+			value, ok := sampleValue(sample)
+			if !ok {
+				continue
+			}
+
+			metric := instrumentation.Metric{
+				Name:  series.name,
+				Value: value,
+				Kind:  series.kind,
+				Unit:  series.unit,
+			}
+
+			for _, label := range sample.GetLabel() {
+				if tag, found := series.tags[label.GetName()]; found {
+					if metric.Tags == nil {
+						metric.Tags = map[string]interface{}{}
+					}
+					metric.Tags[tag] = label.GetValue()
+				}
+			}
+
+			context.Metrics = append(context.Metrics, metric)
+		}
+	}
+
+	return context, nil
+}
+
+func sampleValue(sample *dto.Metric) (interface{}, bool) {
+	switch {
+	case sample.Gauge != nil:
+		return sample.Gauge.GetValue(), true
+	case sample.Counter != nil:
+		return sample.Counter.GetValue(), true
+	case sample.Untyped != nil:
+		return sample.Untyped.GetValue(), true
+	case sample.Histogram != nil:
+		return instrumentation.SummaryValue{
+			Count: sample.Histogram.GetSampleCount(),
+			Sum:   sample.Histogram.GetSampleSum(),
+		}, true
+	case sample.Summary != nil:
+		return instrumentation.SummaryValue{
+			Count: sample.Summary.GetSampleCount(),
+			Sum:   sample.Summary.GetSampleSum(),
+		}, true
+	default:
+		return nil, false
+	}
+}
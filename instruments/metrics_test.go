@@ -0,0 +1,167 @@
+package instruments_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/fakes"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics Instrumentation", func() {
+	var (
+		etcdServer *httptest.Server
+		fixture    string
+		metrics    *instruments.Metrics
+		fakeGetter *fakes.Getter
+	)
+
+	BeforeEach(func() {
+		fakeGetter = &fakes.Getter{}
+		fixture = "etcd-v3.4-metrics.txt"
+	})
+
+	JustBeforeEach(func() {
+		payload, err := ioutil.ReadFile(filepath.Join("fixtures", fixture))
+		Expect(err).NotTo(HaveOccurred())
+
+		etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/metrics" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			w.Write(payload)
+		}))
+
+		metrics = instruments.NewMetrics(fakeGetter, etcdServer.URL)
+	})
+
+	AfterEach(func() {
+		etcdServer.Close()
+	})
+
+	Context("when scraping a follower", func() {
+		It("re-emits the key etcd series", func() {
+			collected, err := metrics.Collect(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(collected.Name).To(Equal("metrics"))
+			Expect(fakeGetter.GetCall.Recieves.Address).To(Equal(etcdServer.URL + "/metrics"))
+
+			Expect(collected.Metrics).To(ConsistOf(
+				instrumentation.Metric{Name: "KeysTotal", Value: 1187.0},
+				instrumentation.Metric{Name: "DbTotalSize", Value: 52002816.0, Unit: instrumentation.BytesUnit},
+				instrumentation.Metric{Name: "DbTotalSizeInUse", Value: 18124800.0, Unit: instrumentation.BytesUnit},
+				instrumentation.Metric{Name: "DeleteTotal", Value: 412.0, Kind: instrumentation.Counter},
+				instrumentation.Metric{Name: "PutTotal", Value: 19876.0, Kind: instrumentation.Counter},
+				instrumentation.Metric{Name: "RangeTotal", Value: 210344.0, Kind: instrumentation.Counter},
+				instrumentation.Metric{Name: "PeerReceivedBytes", Value: 1240000.0, Tags: map[string]interface{}{"from": "0"}, Kind: instrumentation.Counter, Unit: instrumentation.BytesUnit},
+				instrumentation.Metric{Name: "PeerReceivedBytes", Value: 38812000.0, Tags: map[string]interface{}{"from": "8211f1d0f64f3269"}, Kind: instrumentation.Counter, Unit: instrumentation.BytesUnit},
+				instrumentation.Metric{Name: "PeerReceivedBytes", Value: 41062000.0, Tags: map[string]interface{}{"from": "91bc3c398fb3c146"}, Kind: instrumentation.Counter, Unit: instrumentation.BytesUnit},
+				instrumentation.Metric{Name: "PeerSentBytes", Value: 29813000.0, Tags: map[string]interface{}{"to": "8211f1d0f64f3269"}, Kind: instrumentation.Counter, Unit: instrumentation.BytesUnit},
+				instrumentation.Metric{Name: "PeerSentBytes", Value: 30117000.0, Tags: map[string]interface{}{"to": "91bc3c398fb3c146"}, Kind: instrumentation.Counter, Unit: instrumentation.BytesUnit},
+				instrumentation.Metric{Name: "HasLeader", Value: 1.0},
+				instrumentation.Metric{Name: "IsLeader", Value: 0.0},
+				instrumentation.Metric{Name: "LeaderChanges", Value: 3.0, Kind: instrumentation.Counter},
+				instrumentation.Metric{Name: "ProposalsApplied", Value: 20871.0, Kind: instrumentation.Counter},
+				instrumentation.Metric{Name: "ProposalsCommitted", Value: 20871.0, Kind: instrumentation.Counter},
+				instrumentation.Metric{Name: "ProposalsFailed", Value: 2.0, Kind: instrumentation.Counter},
+				instrumentation.Metric{Name: "ProposalsPending", Value: 0.0},
+				instrumentation.Metric{
+					Name:  "WalFsyncDuration",
+					Value: instrumentation.SummaryValue{Count: 20102, Sum: 56.83011},
+					Kind:  instrumentation.Summary,
+					Unit:  instrumentation.SecondsUnit,
+				},
+				instrumentation.Metric{
+					Name:  "BackendCommitDuration",
+					Value: instrumentation.SummaryValue{Count: 12011, Sum: 40.72311},
+					Kind:  instrumentation.Summary,
+					Unit:  instrumentation.SecondsUnit,
+				},
+			))
+		})
+	})
+
+	Context("when scraping the leader", func() {
+		BeforeEach(func() {
+			fixture = "etcd-v3.4-leader-metrics.txt"
+		})
+
+		It("emits only the series that are present", func() {
+			collected, err := metrics.Collect(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(collected.Metrics).To(ConsistOf(
+				instrumentation.Metric{Name: "KeysTotal", Value: 1187.0},
+				instrumentation.Metric{Name: "DbTotalSize", Value: 52002816.0, Unit: instrumentation.BytesUnit},
+				instrumentation.Metric{Name: "HasLeader", Value: 1.0},
+				instrumentation.Metric{Name: "IsLeader", Value: 1.0},
+				instrumentation.Metric{Name: "LeaderChanges", Value: 1.0, Kind: instrumentation.Counter},
+			))
+		})
+	})
+
+	Context("when the endpoint does not serve the Prometheus text format", func() {
+		JustBeforeEach(func() {
+			etcdServer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte("{not metrics"))
+			})
+		})
+
+		It("returns a parse error", func() {
+			collected, err := metrics.Collect(context.Background())
+			Expect(collected.Metrics).To(BeEmpty())
+
+			var collectErr *instrumentation.CollectError
+			Expect(errors.As(err, &collectErr)).To(BeTrue())
+			Expect(collectErr.Context).To(Equal("metrics"))
+			Expect(collectErr.Op).To(Equal("parse"))
+		})
+	})
+
+	Context("when the endpoint cannot be reached", func() {
+		BeforeEach(func() {
+			fakeGetter.GetCall.Returns.Error = errors.New("connection refused")
+		})
+
+		It("returns a fetch error", func() {
+			collected, err := metrics.Collect(context.Background())
+			Expect(collected.Metrics).To(BeEmpty())
+			Expect(err).To(MatchError("failed to fetch metrics metrics: connection refused"))
+		})
+	})
+
+	Context("when the context is done before etcd answers", func() {
+		var unblock chan struct{}
+
+		JustBeforeEach(func() {
+			unblock = make(chan struct{})
+			etcdServer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				<-unblock
+			})
+
+			metrics = instruments.NewMetrics(http.DefaultClient, etcdServer.URL)
+		})
+
+		AfterEach(func() {
+			close(unblock)
+		})
+
+		It("gives up on the request", func() {
+			cancelled, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := metrics.Collect(cancelled)
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		})
+	})
+})
@@ -1,9 +1,11 @@
 package instruments
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
@@ -13,12 +15,36 @@ type Server struct {
 	statsEndpoint string
 	logger        lager.Logger
 	getter        getter
+
+	leader        string
+	leaderChanges uint64
 }
 
 type getter interface {
 	Get(address string) (*http.Response, error)
 }
 
+// requester is implemented by getters, such as *http.Client, that can abandon
+// a request once its context is done.
+type requester interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Get fetches address, giving up when ctx is done if the getter supports it.
+func Get(ctx context.Context, getter getter, address string) (*http.Response, error) {
+	requester, ok := getter.(requester)
+	if !ok {
+		return getter.Get(address)
+	}
+
+	req, err := http.NewRequest("GET", address, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return requester.Do(req.WithContext(ctx))
+}
+
 func NewServer(getter getter, etcdAddr string, logger lager.Logger) *Server {
 	return &Server{
 		statsEndpoint: fmt.Sprintf("%s/v2/stats/self", etcdAddr),
@@ -28,14 +54,37 @@ func NewServer(getter getter, etcdAddr string, logger lager.Logger) *Server {
 	}
 }
 
+// MemberName returns the name the etcd member at etcdAddr reports for itself.
+func MemberName(ctx context.Context, getter getter, etcdAddr string) (string, error) {
+	resp, err := Get(ctx, getter, fmt.Sprintf("%s/v2/stats/self", etcdAddr))
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	var stats RaftServerStats
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	if err != nil {
+		return "", err
+	}
+
+	return stats.Name, nil
+}
+
 func (server *Server) Emit() instrumentation.Context {
+	return server.EmitContext(context.Background())
+}
+
+// EmitContext is Emit with requests that are abandoned once ctx is done.
+func (server *Server) EmitContext(ctx context.Context) instrumentation.Context {
 	context := instrumentation.Context{
 		Name: "server",
 	}
 
 	var stats RaftServerStats
 
-	resp, err := server.getter.Get(server.statsEndpoint)
+	resp, err := Get(ctx, server.getter, server.statsEndpoint)
 	if err != nil {
 		server.logger.Error("failed-to-collect-self-stats", err)
 		return context
@@ -54,36 +103,91 @@ func (server *Server) Emit() instrumentation.Context {
 		isLeader = 1
 	}
 
+	hasLeader := 0
+	if stats.LeaderInfo.Name != "" && stats.LeaderInfo.Name != "0" {
+		hasLeader = 1
+	}
+
+	if hasLeader == 1 {
+		server.observeLeader(stats.LeaderInfo.Name)
+	}
+
 	context.Metrics = []instrumentation.Metric{
 		{
 			Name:  "IsLeader",
 			Value: isLeader,
 		},
+		{
+			Name:  "HasLeader",
+			Value: hasLeader,
+		},
 		{
 			Name:  "SendingBandwidthRate",
 			Value: stats.SendingBandwidthRate,
+			Unit:  instrumentation.BytesPerSecondUnit,
 		},
 		{
 			Name:  "ReceivingBandwidthRate",
 			Value: stats.RecvingBandwidthRate,
+			Unit:  instrumentation.BytesPerSecondUnit,
 		},
 		{
 			Name:  "SendingRequestRate",
 			Value: stats.SendingPkgRate,
+			Unit:  instrumentation.RequestsPerSecondUnit,
 		},
 		{
 			Name:  "ReceivingRequestRate",
 			Value: stats.RecvingPkgRate,
+			Unit:  instrumentation.RequestsPerSecondUnit,
 		},
 		{
 			Name:  "SentAppendRequests",
 			Value: stats.SendAppendRequestCnt,
+			Kind:  instrumentation.Counter,
 		},
 		{
 			Name:  "ReceivedAppendRequests",
 			Value: stats.RecvAppendRequestCnt,
+			Kind:  instrumentation.Counter,
+		},
+		{
+			Name:  "LeaderChanges",
+			Value: server.leaderChanges,
+			Kind:  instrumentation.Counter,
 		},
 	}
 
+	if hasLeader == 1 {
+		uptime, err := time.ParseDuration(stats.LeaderInfo.Uptime)
+		if err != nil {
+			server.logger.Error("failed-to-parse-leader-uptime", err)
+		} else {
+			context.Metrics = append(context.Metrics, instrumentation.Metric{
+				Name:  "LeaderUptime",
+				Value: uptime.Seconds(),
+				Unit:  instrumentation.SecondsUnit,
+			})
+		}
+	}
+
 	return context
 }
+
+// observeLeader counts the times the leader differs from the last one seen.
+// Periods without a leader are not counted, so an election that keeps the same
+// leader is not reported as a change.
+func (server *Server) observeLeader(leader string) {
+	previous := server.leader
+	server.leader = leader
+
+	if previous == "" || previous == leader {
+		return
+	}
+
+	server.leaderChanges++
+	server.logger.Info("leader-changed", lager.Data{
+		"previous-leader": previous,
+		"leader":          leader,
+	})
+}
@@ -1,6 +1,8 @@
 package instruments_test
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 
@@ -37,8 +39,8 @@ var _ = Describe("Server Instrumentation", func() {
 									"state": "StateLeader",
 
 									"leaderInfo": {
-										"name": "node1",
-										"uptime": "forever"
+										"leader": "node1",
+										"uptime": "10m59.322358947s"
 									},
 
 									"recvAppendRequestCnt": 1234,
@@ -70,34 +72,143 @@ var _ = Describe("Server Instrumentation", func() {
 					Value: 1,
 				}))
 
+				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
+					Name:  "HasLeader",
+					Value: 1,
+				}))
+
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "SendingBandwidthRate",
 					Value: 1211109.8,
+					Unit:  instrumentation.BytesPerSecondUnit,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "ReceivingBandwidthRate",
 					Value: 9101112.13,
+					Unit:  instrumentation.BytesPerSecondUnit,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "SendingRequestRate",
 					Value: 8765.0,
+					Unit:  instrumentation.RequestsPerSecondUnit,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "ReceivingRequestRate",
 					Value: 5678.0,
+					Unit:  instrumentation.RequestsPerSecondUnit,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "SentAppendRequests",
 					Value: uint64(4321),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "ReceivedAppendRequests",
 					Value: uint64(1234),
+					Kind:  instrumentation.Counter,
+				}))
+
+				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
+					Name:  "LeaderUptime",
+					Value: 659.322358947,
+					Unit:  instrumentation.SecondsUnit,
+				}))
+
+				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
+					Name:  "LeaderChanges",
+					Value: uint64(0),
+					Kind:  instrumentation.Counter,
+				}))
+			})
+		})
+
+		Context("when the leader changes between scrapes", func() {
+			var (
+				leaders []string
+				logger  *lagertest.TestLogger
+			)
+
+			leaderChanges := func() interface{} {
+				for _, metric := range server.Emit().Metrics {
+					if metric.Name == "LeaderChanges" {
+						return metric.Value
+					}
+				}
+				return nil
+			}
+
+			BeforeEach(func() {
+				leaders = []string{"node1", "node1", "", "node1", "node2", "node3"}
+
+				etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.Write([]byte(`{"name": "node1", "leaderInfo": {"leader": "` + leaders[0] + `", "uptime": "1s"}}`))
+					leaders = leaders[1:]
+				}))
+
+				logger = lagertest.NewTestLogger("test")
+				server = instruments.NewServer(fakeGetter, etcdServer.URL, logger)
+			})
+
+			It("counts the changes and logs the old and new leader", func() {
+				Expect(leaderChanges()).To(Equal(uint64(0)))
+
+				By("not counting a scrape that sees the same leader")
+				Expect(leaderChanges()).To(Equal(uint64(0)))
+
+				By("not counting an election that keeps the same leader")
+				Expect(leaderChanges()).To(Equal(uint64(0)))
+				Expect(leaderChanges()).To(Equal(uint64(0)))
+
+				By("counting every new leader")
+				Expect(leaderChanges()).To(Equal(uint64(1)))
+				Expect(leaderChanges()).To(Equal(uint64(2)))
+
+				logs := logger.Logs()
+				Expect(logs).To(HaveLen(2))
+				Expect(logs[0].Message).To(Equal("test.leader-changed"))
+				Expect(logs[0].Data).To(HaveKeyWithValue("previous-leader", "node1"))
+				Expect(logs[0].Data).To(HaveKeyWithValue("leader", "node2"))
+				Expect(logs[1].Data).To(HaveKeyWithValue("previous-leader", "node2"))
+				Expect(logs[1].Data).To(HaveKeyWithValue("leader", "node3"))
+			})
+		})
+
+		Context("when the etcd server does not know the leader", func() {
+			BeforeEach(func() {
+				etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					switch req.URL.Path {
+					case "/v2/stats/self":
+						if req.Method == "GET" {
+							w.Write([]byte(`
+								{
+									"name": "node1",
+									"state": "StateFollower",
+									"leaderInfo": {
+										"leader": "",
+										"uptime": ""
+									}
+								}
+							`))
+							return
+						}
+					}
+					w.WriteHeader(http.StatusTeapot)
+				}))
+
+				server = instruments.NewServer(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+			})
+
+			It("reports that there is no leader", func() {
+				context := server.Emit()
+
+				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
+					Name:  "HasLeader",
+					Value: 0,
 				}))
 			})
 		})
@@ -135,4 +246,61 @@ var _ = Describe("Server Instrumentation", func() {
 			Expect(context.Metrics).Should(BeEmpty())
 		})
 	})
+
+	Context("when the context is done before etcd answers", func() {
+		var unblock chan struct{}
+
+		BeforeEach(func() {
+			unblock = make(chan struct{})
+			etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				<-unblock
+			}))
+			server = instruments.NewServer(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+		})
+
+		AfterEach(func() {
+			close(unblock)
+		})
+
+		It("gives up on the request", func() {
+			cancelled, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			context := server.EmitContext(cancelled)
+			Expect(fakeGetter.GetCall.CallCount).To(Equal(1))
+			Expect(context.Metrics).To(BeNil())
+		})
+	})
+
+	Describe("MemberName", func() {
+		BeforeEach(func() {
+			etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v2/stats/self":
+					if req.Method == "GET" {
+						w.Write([]byte(`{"name": "node1", "state": "StateLeader"}`))
+						return
+					}
+				}
+				w.WriteHeader(http.StatusTeapot)
+			}))
+		})
+
+		It("returns the name the member reports for itself", func() {
+			name, err := instruments.MemberName(context.Background(), fakeGetter, etcdServer.URL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("node1"))
+		})
+
+		Context("when the stats cannot be fetched", func() {
+			BeforeEach(func() {
+				fakeGetter.GetCall.Returns.Error = errors.New("boom")
+			})
+
+			It("returns the error", func() {
+				_, err := instruments.MemberName(context.Background(), fakeGetter, etcdServer.URL)
+				Expect(err).To(MatchError("boom"))
+			})
+		})
+	})
 })
@@ -0,0 +1,147 @@
+package instruments_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeEtcdServer struct {
+	etcdserverpb.UnimplementedMaintenanceServer
+	etcdserverpb.UnimplementedClusterServer
+
+	statusResponse  *etcdserverpb.StatusResponse
+	membersResponse *etcdserverpb.MemberListResponse
+	err             error
+}
+
+func (s *fakeEtcdServer) Status(context.Context, *etcdserverpb.StatusRequest) (*etcdserverpb.StatusResponse, error) {
+	return s.statusResponse, s.err
+}
+
+func (s *fakeEtcdServer) MemberList(context.Context, *etcdserverpb.MemberListRequest) (*etcdserverpb.MemberListResponse, error) {
+	return s.membersResponse, s.err
+}
+
+var _ = Describe("Status Instrumentation", func() {
+	var (
+		fakeServer *fakeEtcdServer
+		grpcServer *grpc.Server
+		conn       *grpc.ClientConn
+		status     *instruments.Status
+	)
+
+	BeforeEach(func() {
+		fakeServer = &fakeEtcdServer{
+			statusResponse: &etcdserverpb.StatusResponse{
+				Version:          "3.4.13",
+				DbSize:           52002816,
+				DbSizeInUse:      18124800,
+				Leader:           0x8211f1d0f64f3269,
+				RaftIndex:        20871,
+				RaftAppliedIndex: 20870,
+				RaftTerm:         4,
+			},
+			membersResponse: &etcdserverpb.MemberListResponse{
+				Members: []*etcdserverpb.Member{
+					{ID: 0x8211f1d0f64f3269, Name: "node1"},
+					{ID: 0x91bc3c398fb3c146, Name: "node2"},
+					{ID: 0xfd422379fda50e48, Name: "node3"},
+				},
+			},
+		}
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		grpcServer = grpc.NewServer()
+		etcdserverpb.RegisterMaintenanceServer(grpcServer, fakeServer)
+		etcdserverpb.RegisterClusterServer(grpcServer, fakeServer)
+		go grpcServer.Serve(listener)
+
+		conn, err = grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).NotTo(HaveOccurred())
+
+		status = instruments.NewStatus(conn, timeout)
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		grpcServer.Stop()
+	})
+
+	It("emits the member status and the cluster size", func() {
+		collected, err := status.Collect(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(collected.Name).To(Equal("status"))
+		Expect(collected.Metrics).To(Equal([]instrumentation.Metric{
+			{Name: "DbSize", Value: int64(52002816), Unit: instrumentation.BytesUnit},
+			{Name: "DbSizeInUse", Value: int64(18124800), Unit: instrumentation.BytesUnit},
+			{Name: "RaftIndex", Value: uint64(20871)},
+			{Name: "RaftAppliedIndex", Value: uint64(20870)},
+			{Name: "RaftTerm", Value: uint64(4)},
+			{Name: "Leader", Value: 1, Tags: map[string]interface{}{"leader": "8211f1d0f64f3269"}},
+			{Name: "Members", Value: 3},
+		}))
+	})
+
+	Context("when the member does not know the leader", func() {
+		BeforeEach(func() {
+			fakeServer.statusResponse.Leader = 0
+		})
+
+		It("emits the leader without a tag", func() {
+			collected, err := status.Collect(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(collected.Metrics).To(ContainElement(instrumentation.Metric{Name: "Leader", Value: 0}))
+		})
+	})
+
+	Context("when the member cannot be reached", func() {
+		BeforeEach(func() {
+			fakeServer.err = errors.New("etcdserver: request timed out")
+		})
+
+		It("returns a fetch error", func() {
+			collected, err := status.Collect(context.Background())
+			Expect(collected.Metrics).To(BeEmpty())
+			Expect(err).To(MatchError(ContainSubstring("failed to fetch status metrics")))
+			Expect(err).To(MatchError(ContainSubstring("etcdserver: request timed out")))
+		})
+	})
+
+	Context("when the member does not answer in time", func() {
+		BeforeEach(func() {
+			status = instruments.NewStatus(conn, time.Nanosecond)
+		})
+
+		It("returns the deadline error", func() {
+			collected, err := status.Collect(context.Background())
+			Expect(collected.Metrics).To(BeEmpty())
+
+			var collectErr *instrumentation.CollectError
+			Expect(errors.As(err, &collectErr)).To(BeTrue())
+			Expect(collectErr.Op).To(Equal("fetch"))
+		})
+	})
+
+	Context("when the context is cancelled", func() {
+		It("does not wait for the member", func() {
+			cancelled, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := status.Collect(cancelled)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -1,8 +1,10 @@
 package instruments
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
 
@@ -10,30 +12,41 @@ import (
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
 )
 
+// Store reports the v2 store stats and the indexes returned with a read of
+// the keyspace. The raft index and term are only read from the response
+// headers with raftHeaders, as the status instrument reports them too, and are
+// left out when the member does not send them.
 type Store struct {
 	statsEndpoint string
 	keysEndpoint  string
+	raftHeaders   bool
 	getter        getter
 	logger        lager.Logger
 }
 
-func NewStore(getter getter, etcdAddr string, logger lager.Logger) *Store {
+func NewStore(getter getter, etcdAddr string, raftHeaders bool, logger lager.Logger) *Store {
 	return &Store{
 		statsEndpoint: fmt.Sprintf("%s/v2/stats/store", etcdAddr),
 		keysEndpoint:  fmt.Sprintf("%s/v2/keys/", etcdAddr),
+		raftHeaders:   raftHeaders,
 		getter:        getter,
 		logger:        logger,
 	}
 }
 
 func (store *Store) Emit() instrumentation.Context {
+	return store.EmitContext(context.Background())
+}
+
+// EmitContext is Emit with requests that are abandoned once ctx is done.
+func (store *Store) EmitContext(ctx context.Context) instrumentation.Context {
 	context := instrumentation.Context{
 		Name: "store",
 	}
 
 	var stats map[string]uint64
 
-	statsResp, err := store.getter.Get(store.statsEndpoint)
+	statsResp, err := Get(ctx, store.getter, store.statsEndpoint)
 	if err != nil {
 		store.logger.Error("failed-to-collect-store-stats", err)
 		return context
@@ -47,7 +60,7 @@ func (store *Store) Emit() instrumentation.Context {
 		return context
 	}
 
-	keysResp, err := store.getter.Get(store.keysEndpoint)
+	keysResp, err := Get(ctx, store.getter, store.keysEndpoint)
 	if err != nil {
 		store.logger.Error("failed-to-read-from-store", err)
 		return context
@@ -56,8 +69,6 @@ func (store *Store) Emit() instrumentation.Context {
 	defer keysResp.Body.Close()
 
 	etcdIndexHeader := keysResp.Header.Get("X-Etcd-Index")
-	raftIndexHeader := keysResp.Header.Get("X-Raft-Index")
-	raftTermHeader := keysResp.Header.Get("X-Raft-Term")
 
 	etcdIndex, err := strconv.ParseUint(etcdIndexHeader, 10, 0)
 	if err != nil {
@@ -67,43 +78,62 @@ func (store *Store) Emit() instrumentation.Context {
 		return context
 	}
 
-	raftIndex, err := strconv.ParseUint(raftIndexHeader, 10, 0)
-	if err != nil {
-		store.logger.Error("failed-to-parse-raft-index", err, lager.Data{
-			"index": raftIndexHeader,
-		})
-		return context
-	}
-
-	raftTerm, err := strconv.ParseUint(raftTermHeader, 10, 0)
-	if err != nil {
-		store.logger.Error("failed-to-parse-raft-term", err, lager.Data{
-			"term": raftTermHeader,
-		})
-		return context
-	}
-
 	context.Metrics = []instrumentation.Metric{
 		{
 			Name:  "EtcdIndex",
 			Value: etcdIndex,
 		},
-		{
-			Name:  "RaftIndex",
-			Value: raftIndex,
-		},
-		{
-			Name:  "RaftTerm",
-			Value: raftTerm,
-		},
+	}
+
+	if store.raftHeaders {
+		context.Metrics = append(context.Metrics, store.raftMetrics(keysResp.Header)...)
 	}
 
 	for name, val := range stats {
-		context.Metrics = append(context.Metrics, instrumentation.Metric{
+		metric := instrumentation.Metric{
 			Name:  strings.ToUpper(name[0:1]) + name[1:],
 			Value: val,
-		})
+		}
+
+		// every store stat but the number of watchers counts operations since
+		// the member started
+		if name != "watchers" {
+			metric.Kind = instrumentation.Counter
+		}
+
+		context.Metrics = append(context.Metrics, metric)
 	}
 
 	return context
 }
+
+// raftMetrics returns the raft index and term found in the headers.
+func (store *Store) raftMetrics(header http.Header) []instrumentation.Metric {
+	metrics := []instrumentation.Metric{}
+
+	for _, raft := range []struct{ header, name string }{
+		{"X-Raft-Index", "RaftIndex"},
+		{"X-Raft-Term", "RaftTerm"},
+	} {
+		value := header.Get(raft.header)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			store.logger.Error("failed-to-parse-raft-header", err, lager.Data{
+				"header": raft.header,
+				"value":  value,
+			})
+			continue
+		}
+
+		metrics = append(metrics, instrumentation.Metric{
+			Name:  raft.name,
+			Value: parsed,
+		})
+	}
+
+	return metrics
+}
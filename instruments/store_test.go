@@ -16,13 +16,15 @@ import (
 
 var _ = Describe("Store Instrumentation", func() {
 	var (
-		etcdServer *httptest.Server
-		store      *instruments.Store
-		fakeGetter *fakes.Getter
+		etcdServer      *httptest.Server
+		store           *instruments.Store
+		fakeGetter      *fakes.Getter
+		sendRaftHeaders bool
 	)
 
 	BeforeEach(func() {
 		fakeGetter = &fakes.Getter{}
+		sendRaftHeaders = true
 	})
 
 	Context("when the metrics fetch succesfully", func() {
@@ -58,15 +60,17 @@ var _ = Describe("Store Instrumentation", func() {
 					case "/v2/keys/":
 						if req.Method == "GET" {
 							w.Header().Set("X-Etcd-Index", "10001")
-							w.Header().Set("X-Raft-Index", "10204")
-							w.Header().Set("X-Raft-Term", "1234")
+							if sendRaftHeaders {
+								w.Header().Set("X-Raft-Index", "10204")
+								w.Header().Set("X-Raft-Term", "1234")
+							}
 							w.WriteHeader(http.StatusOK)
 							return
 						}
 					}
 					w.WriteHeader(http.StatusTeapot)
 				}))
-				store = instruments.NewStore(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+				store = instruments.NewStore(fakeGetter, etcdServer.URL, true, lagertest.NewTestLogger("test"))
 			})
 
 			It("should return them", func() {
@@ -93,66 +97,79 @@ var _ = Describe("Store Instrumentation", func() {
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "CompareAndSwapFail",
 					Value: uint64(1),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "CompareAndSwapSuccess",
 					Value: uint64(2),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "CreateFail",
 					Value: uint64(3),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "CreateSuccess",
 					Value: uint64(4),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "DeleteFail",
 					Value: uint64(5),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "DeleteSuccess",
 					Value: uint64(6),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "ExpireCount",
 					Value: uint64(7),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "GetsFail",
 					Value: uint64(8),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "GetsSuccess",
 					Value: uint64(9),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "SetsFail",
 					Value: uint64(10),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "SetsSuccess",
 					Value: uint64(11),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "UpdateFail",
 					Value: uint64(12),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
 					Name:  "UpdateSuccess",
 					Value: uint64(13),
+					Kind:  instrumentation.Counter,
 				}))
 
 				Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
@@ -160,6 +177,37 @@ var _ = Describe("Store Instrumentation", func() {
 					Value: uint64(14),
 				}))
 			})
+
+			Context("when the member does not send the raft headers", func() {
+				BeforeEach(func() {
+					sendRaftHeaders = false
+				})
+
+				It("returns the other metrics", func() {
+					context := store.Emit()
+
+					Expect(context.Metrics).Should(ContainElement(instrumentation.Metric{
+						Name:  "EtcdIndex",
+						Value: uint64(10001),
+					}))
+					Expect(context.Metrics).Should(HaveLen(15))
+				})
+			})
+
+			Context("when the raft index and term are collected by the status instrument", func() {
+				BeforeEach(func() {
+					store = instruments.NewStore(fakeGetter, etcdServer.URL, false, lagertest.NewTestLogger("test"))
+				})
+
+				It("does not report them", func() {
+					context := store.Emit()
+
+					for _, metric := range context.Metrics {
+						Expect(metric.Name).NotTo(HavePrefix("Raft"))
+					}
+					Expect(context.Metrics).Should(HaveLen(15))
+				})
+			})
 		})
 
 		Context("when the etcd server gives invalid JSON", func() {
@@ -174,7 +222,7 @@ var _ = Describe("Store Instrumentation", func() {
 					}
 					w.WriteHeader(http.StatusTeapot)
 				}))
-				store = instruments.NewStore(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+				store = instruments.NewStore(fakeGetter, etcdServer.URL, true, lagertest.NewTestLogger("test"))
 			})
 
 			It("does not report any metrics", func() {
@@ -195,7 +243,7 @@ var _ = Describe("Store Instrumentation", func() {
 					}
 					w.WriteHeader(http.StatusTeapot)
 				}))
-				store = instruments.NewStore(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+				store = instruments.NewStore(fakeGetter, etcdServer.URL, true, lagertest.NewTestLogger("test"))
 			})
 
 			It("does not report any metrics", func() {
@@ -210,7 +258,7 @@ var _ = Describe("Store Instrumentation", func() {
 			etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 				w.WriteHeader(http.StatusTeapot)
 			}))
-			store = instruments.NewStore(fakeGetter, etcdServer.URL, lagertest.NewTestLogger("test"))
+			store = instruments.NewStore(fakeGetter, etcdServer.URL, true, lagertest.NewTestLogger("test"))
 		})
 
 		It("should not return them", func() {
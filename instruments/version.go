@@ -0,0 +1,93 @@
+package instruments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+// EtcdVersion is the body of etcd's /version endpoint.
+type EtcdVersion struct {
+	Server  string `json:"etcdserver"`
+	Cluster string `json:"etcdcluster"`
+}
+
+// Version reports the etcd server and cluster versions last detected with
+// Detect.
+type Version struct {
+	versionEndpoint string
+	getter          getter
+	logger          lager.Logger
+
+	version  EtcdVersion
+	detected bool
+}
+
+// ErrUnknownVersion is returned by Detect when the member answered without a
+// version that could be read, as opposed to not answering at all.
+var ErrUnknownVersion = errors.New("etcd did not report its server version")
+
+func NewVersion(getter getter, etcdAddr string, logger lager.Logger) *Version {
+	return &Version{
+		versionEndpoint: fmt.Sprintf("%s/version", etcdAddr),
+		getter:          getter,
+		logger:          logger,
+	}
+}
+
+func (version *Version) Detect(ctx context.Context) (EtcdVersion, error) {
+	resp, err := Get(ctx, version.getter, version.versionEndpoint)
+	if err != nil {
+		return EtcdVersion{}, err
+	}
+
+	defer resp.Body.Close()
+
+	// a member that is starting up or shutting down may answer with an error
+	if resp.StatusCode != http.StatusOK {
+		return EtcdVersion{}, fmt.Errorf("etcd answered the version request with %s", resp.Status)
+	}
+
+	var detected EtcdVersion
+	err = json.NewDecoder(resp.Body).Decode(&detected)
+	if err != nil {
+		return EtcdVersion{}, fmt.Errorf("%w: %s", ErrUnknownVersion, err)
+	}
+
+	if detected.Server == "" {
+		return EtcdVersion{}, ErrUnknownVersion
+	}
+
+	version.version = detected
+	version.detected = true
+
+	return detected, nil
+}
+
+func (version *Version) Emit() instrumentation.Context {
+	context := instrumentation.Context{
+		Name: "version",
+	}
+
+	if !version.detected {
+		return context
+	}
+
+	context.Metrics = []instrumentation.Metric{
+		{
+			Name:  "Version",
+			Value: 1,
+			Tags: map[string]interface{}{
+				"etcdserver":  version.version.Server,
+				"etcdcluster": version.version.Cluster,
+			},
+		},
+	}
+
+	return context
+}
@@ -0,0 +1,104 @@
+package instruments_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/fakes"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
+	"github.com/onsi/gomega/ghttp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Version Instrumentation", func() {
+	var (
+		etcdServer *ghttp.Server
+		version    *instruments.Version
+	)
+
+	BeforeEach(func() {
+		etcdServer = ghttp.NewServer()
+		version = instruments.NewVersion(&fakes.Getter{}, etcdServer.URL(), lagertest.NewTestLogger("test"))
+	})
+
+	AfterEach(func() {
+		etcdServer.Close()
+	})
+
+	Context("when the version has been detected", func() {
+		BeforeEach(func() {
+			etcdServer.RouteToHandler("GET", "/version", ghttp.RespondWith(http.StatusOK, `{"etcdserver":"3.4.13","etcdcluster":"3.4.0"}`))
+		})
+
+		It("returns it", func() {
+			detected, err := version.Detect(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(detected).To(Equal(instruments.EtcdVersion{Server: "3.4.13", Cluster: "3.4.0"}))
+		})
+
+		It("emits it as tags", func() {
+			_, err := version.Detect(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			emitted := version.Emit()
+			Expect(emitted.Name).To(Equal("version"))
+			Expect(emitted.Metrics).To(Equal([]instrumentation.Metric{
+				{
+					Name:  "Version",
+					Value: 1,
+					Tags: map[string]interface{}{
+						"etcdserver":  "3.4.13",
+						"etcdcluster": "3.4.0",
+					},
+				},
+			}))
+		})
+	})
+
+	Context("when the version has not been detected", func() {
+		It("does not report any metrics", func() {
+			Expect(version.Emit().Metrics).To(BeEmpty())
+		})
+	})
+
+	Context("when etcd does not report a version", func() {
+		BeforeEach(func() {
+			etcdServer.RouteToHandler("GET", "/version", ghttp.RespondWith(http.StatusOK, `{}`))
+		})
+
+		It("returns an error", func() {
+			_, err := version.Detect(context.Background())
+			Expect(err).To(MatchError(instruments.ErrUnknownVersion))
+			Expect(version.Emit().Metrics).To(BeEmpty())
+		})
+	})
+
+	Context("when etcd answers with an error", func() {
+		BeforeEach(func() {
+			etcdServer.RouteToHandler("GET", "/version", ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+		})
+
+		It("returns an error that does not tell the version is unknown", func() {
+			_, err := version.Detect(context.Background())
+			Expect(err).To(MatchError("etcd answered the version request with 503 Service Unavailable"))
+			Expect(errors.Is(err, instruments.ErrUnknownVersion)).To(BeFalse())
+		})
+	})
+
+	Context("when etcd reports a version that cannot be read", func() {
+		BeforeEach(func() {
+			etcdServer.RouteToHandler("GET", "/version", ghttp.RespondWith(http.StatusOK, `etcd 2.0.0`))
+		})
+
+		It("returns an unknown version error", func() {
+			_, err := version.Detect(context.Background())
+			Expect(errors.Is(err, instruments.ErrUnknownVersion)).To(BeTrue())
+			Expect(version.Emit().Metrics).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,65 @@
+package runners
+
+import "time"
+
+// breaker stops a member from being scraped once threshold collections in a
+// row have failed to reach it. The member is then only probed, after a backoff
+// that starts at minBackoff and doubles on every failed probe up to
+// maxBackoff.
+type breaker struct {
+	threshold  int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	failures int
+	open     bool
+	backoff  time.Duration
+	retryAt  time.Time
+}
+
+func newBreaker(threshold int, minBackoff, maxBackoff time.Duration) *breaker {
+	return &breaker{
+		threshold:  threshold,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+	}
+}
+
+// allow reports whether the member may be probed at now.
+func (b *breaker) allow(now time.Time) bool {
+	return !b.open || !now.Before(b.retryAt)
+}
+
+// succeed closes the breaker and returns whether it was open.
+func (b *breaker) succeed() bool {
+	wasOpen := b.open
+
+	b.failures = 0
+	b.open = false
+	b.backoff = 0
+
+	return wasOpen
+}
+
+// fail records a failure at now and returns whether it opened the breaker.
+func (b *breaker) fail(now time.Time) bool {
+	b.failures++
+
+	if b.open {
+		b.backoff *= 2
+		if b.backoff > b.maxBackoff {
+			b.backoff = b.maxBackoff
+		}
+		b.retryAt = now.Add(b.backoff)
+		return false
+	}
+
+	if b.failures < b.threshold {
+		return false
+	}
+
+	b.open = true
+	b.backoff = b.minBackoff
+	b.retryAt = now.Add(b.backoff)
+	return true
+}
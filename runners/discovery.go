@@ -0,0 +1,233 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
+)
+
+// EtcdMember identifies an etcd member to collect metrics from. Name is empty
+// when a single member is monitored, in which case metrics are not tagged with
+// it.
+type EtcdMember struct {
+	Name string
+	URL  string
+}
+
+// Discoverer lists the etcd members to collect metrics from. Requests it
+// makes to the members are given up once ctx is done, and are only made to
+// the members at the URLs reachable returns true for, so that members that are
+// being backed off from are left alone.
+type Discoverer interface {
+	Discover(ctx context.Context, reachable func(etcdURL string) bool) ([]EtcdMember, error)
+}
+
+// errBackingOff is the error of a member that was not asked for anything, as
+// it is being backed off from.
+var errBackingOff = errors.New("backing off from the member")
+
+// SingleMemberDiscoverer always returns the one member the server is
+// colocated with, without a name. The name the member reports is looked up
+// while discovering until it is known, for the sinks that attribute metrics
+// to the member, and is returned by Name.
+type SingleMemberDiscoverer struct {
+	etcdURL string
+	names   *memberNames
+}
+
+func NewSingleMemberDiscoverer(getter getter, etcdURL string) *SingleMemberDiscoverer {
+	return &SingleMemberDiscoverer{
+		etcdURL: etcdURL,
+		names:   newMemberNames(getter),
+	}
+}
+
+func (d *SingleMemberDiscoverer) Discover(ctx context.Context, reachable func(etcdURL string) bool) ([]EtcdMember, error) {
+	d.names.members(ctx, []string{d.etcdURL}, reachable)
+	return []EtcdMember{{URL: d.etcdURL}}, nil
+}
+
+// Name returns the name the member reports for itself, or an empty string
+// until it has answered.
+func (d *SingleMemberDiscoverer) Name() string {
+	return d.names.name(d.etcdURL)
+}
+
+// StaticDiscoverer returns a fixed list of members, named after the name each
+// member reports for itself. Until a member can be reached it is named after
+// its address.
+type StaticDiscoverer struct {
+	etcdURLs []string
+	names    *memberNames
+}
+
+func NewStaticDiscoverer(getter getter, etcdURLs []string) *StaticDiscoverer {
+	return &StaticDiscoverer{
+		etcdURLs: etcdURLs,
+		names:    newMemberNames(getter),
+	}
+}
+
+func (d *StaticDiscoverer) Discover(ctx context.Context, reachable func(etcdURL string) bool) ([]EtcdMember, error) {
+	return d.names.members(ctx, d.etcdURLs, reachable), nil
+}
+
+// V2MembersDiscoverer lists the members of the cluster through the v2 members
+// API of the first seed member that answers. The list is asked for again once
+// refreshInterval has passed.
+type V2MembersDiscoverer struct {
+	getter          getter
+	seedURLs        []string
+	refreshInterval time.Duration
+	clock           clock.Clock
+
+	members  []EtcdMember
+	listedAt time.Time
+}
+
+func NewV2MembersDiscoverer(getter getter, seedURLs []string, refreshInterval time.Duration, clock clock.Clock) *V2MembersDiscoverer {
+	return &V2MembersDiscoverer{
+		getter:          getter,
+		seedURLs:        seedURLs,
+		refreshInterval: refreshInterval,
+		clock:           clock,
+	}
+}
+
+type v2Members struct {
+	Members []struct {
+		Name       string   `json:"name"`
+		ClientURLs []string `json:"clientURLs"`
+	} `json:"members"`
+}
+
+func (d *V2MembersDiscoverer) Discover(ctx context.Context, reachable func(etcdURL string) bool) ([]EtcdMember, error) {
+	if d.members != nil && d.clock.Since(d.listedAt) < d.refreshInterval {
+		return d.members, nil
+	}
+
+	var lastErr error
+
+	for _, seedURL := range d.seedURLs {
+		if !reachable(seedURL) {
+			lastErr = errBackingOff
+			continue
+		}
+
+		members, err := d.discoverFrom(ctx, seedURL)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		d.members = members
+		d.listedAt = d.clock.Now()
+		return members, nil
+	}
+
+	return nil, fmt.Errorf("failed to list members from any of %v: %s", d.seedURLs, lastErr)
+}
+
+func (d *V2MembersDiscoverer) discoverFrom(ctx context.Context, seedURL string) ([]EtcdMember, error) {
+	resp, err := instruments.Get(ctx, d.getter, seedURL+"/v2/members")
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var list v2Members
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []EtcdMember{}
+	for _, member := range list.Members {
+		// members that have been added but not started yet have no name and
+		// serve no clients
+		if member.Name == "" || len(member.ClientURLs) == 0 {
+			continue
+		}
+
+		members = append(members, EtcdMember{Name: member.Name, URL: member.ClientURLs[0]})
+	}
+
+	return members, nil
+}
+
+// memberNames looks up and remembers the name each member reports for itself.
+// Until a member has answered it is named after its address.
+type memberNames struct {
+	getter getter
+
+	lock  sync.Mutex
+	names map[string]string
+}
+
+func newMemberNames(getter getter) *memberNames {
+	return &memberNames{
+		getter: getter,
+		names:  map[string]string{},
+	}
+}
+
+// members names the members at etcdURLs, looking up the names not known yet
+// of the reachable members concurrently and giving up on them once ctx is
+// done.
+func (n *memberNames) members(ctx context.Context, etcdURLs []string, reachable func(etcdURL string) bool) []EtcdMember {
+	wg := sync.WaitGroup{}
+	for _, etcdURL := range etcdURLs {
+		if n.name(etcdURL) != "" || !reachable(etcdURL) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(etcdURL string) {
+			defer wg.Done()
+
+			name, err := instruments.MemberName(ctx, n.getter, etcdURL)
+			if err == nil && name != "" {
+				n.lock.Lock()
+				n.names[etcdURL] = name
+				n.lock.Unlock()
+			}
+		}(etcdURL)
+	}
+	wg.Wait()
+
+	members := make([]EtcdMember, 0, len(etcdURLs))
+	for _, etcdURL := range etcdURLs {
+		name := n.name(etcdURL)
+		if name == "" {
+			name = hostOf(etcdURL)
+		}
+
+		members = append(members, EtcdMember{Name: name, URL: etcdURL})
+	}
+
+	return members
+}
+
+func (n *memberNames) name(etcdURL string) string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return n.names[etcdURL]
+}
+
+func hostOf(etcdURL string) string {
+	parsed, err := url.Parse(etcdURL)
+	if err != nil || parsed.Host == "" {
+		return etcdURL
+	}
+
+	return parsed.Host
+}
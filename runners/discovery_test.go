@@ -0,0 +1,217 @@
+package runners_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/fakes"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+	"github.com/onsi/gomega/ghttp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// everyMember lets the discoverers ask every member.
+func everyMember(string) bool {
+	return true
+}
+
+var _ = Describe("Discovery", func() {
+	var (
+		etcdServer *ghttp.Server
+		fakeClock  *fakeclock.FakeClock
+	)
+
+	BeforeEach(func() {
+		etcdServer = ghttp.NewServer()
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+	})
+
+	AfterEach(func() {
+		etcdServer.Close()
+	})
+
+	Describe("SingleMemberDiscoverer", func() {
+		It("returns the member without a name", func() {
+			etcdServer.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(http.StatusOK, `{"name":"node1"}`))
+
+			members, err := runners.NewSingleMemberDiscoverer(&fakes.Getter{}, etcdServer.URL()).Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(Equal([]runners.EtcdMember{{URL: etcdServer.URL()}}))
+		})
+
+		It("looks up the name the member reports until it has answered", func() {
+			discoverer := runners.NewSingleMemberDiscoverer(&fakes.Getter{}, etcdServer.URL())
+
+			etcdServer.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+			_, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(discoverer.Name()).To(BeEmpty())
+
+			etcdServer.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(http.StatusOK, `{"name":"node1"}`))
+			_, err = discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(discoverer.Name()).To(Equal("node1"))
+
+			_, err = discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(etcdServer.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("does not look up the name of a member that is being backed off from", func() {
+			discoverer := runners.NewSingleMemberDiscoverer(&fakes.Getter{}, etcdServer.URL())
+
+			_, err := discoverer.Discover(context.Background(), func(string) bool { return false })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(etcdServer.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Describe("StaticDiscoverer", func() {
+		It("names each member after the name it reports", func() {
+			etcdServer.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(http.StatusOK, `{"name":"node1"}`))
+
+			members, err := runners.NewStaticDiscoverer(&fakes.Getter{}, []string{etcdServer.URL()}).Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(Equal([]runners.EtcdMember{{Name: "node1", URL: etcdServer.URL()}}))
+		})
+
+		It("names members that cannot be reached after their address", func() {
+			etcdServer.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+
+			members, err := runners.NewStaticDiscoverer(&fakes.Getter{}, []string{etcdServer.URL()}).Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(Equal([]runners.EtcdMember{
+				{Name: strings.TrimPrefix(etcdServer.URL(), "http://"), URL: etcdServer.URL()},
+			}))
+		})
+
+		It("only looks each name up once", func() {
+			etcdServer.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(http.StatusOK, `{"name":"node1"}`))
+
+			discoverer := runners.NewStaticDiscoverer(&fakes.Getter{}, []string{etcdServer.URL()})
+			_, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(etcdServer.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		It("does not look up the names of the members being backed off from", func() {
+			etcdServer.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(http.StatusOK, `{"name":"node1"}`))
+
+			members, err := runners.NewStaticDiscoverer(&fakes.Getter{}, []string{etcdServer.URL()}).Discover(context.Background(), func(string) bool { return false })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(Equal([]runners.EtcdMember{
+				{Name: strings.TrimPrefix(etcdServer.URL(), "http://"), URL: etcdServer.URL()},
+			}))
+			Expect(etcdServer.ReceivedRequests()).To(BeEmpty())
+		})
+
+		It("looks the names up concurrently and gives up on them once the context is done", func() {
+			slowServer := ghttp.NewServer()
+			defer slowServer.Close()
+
+			release := make(chan struct{})
+			defer close(release)
+			slowServer.RouteToHandler("GET", "/v2/stats/self", func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			})
+			etcdServer.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(http.StatusOK, `{"name":"node1"}`))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			started := time.Now()
+			members, err := runners.NewStaticDiscoverer(&fakes.Getter{}, []string{slowServer.URL(), etcdServer.URL()}).Discover(ctx, everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Since(started)).To(BeNumerically("<", time.Second))
+			Expect(members).To(Equal([]runners.EtcdMember{
+				{Name: strings.TrimPrefix(slowServer.URL(), "http://"), URL: slowServer.URL()},
+				{Name: "node1", URL: etcdServer.URL()},
+			}))
+		})
+	})
+
+	Describe("V2MembersDiscoverer", func() {
+		It("returns the started members with their first client URL", func() {
+			etcdServer.RouteToHandler("GET", "/v2/members", ghttp.RespondWith(http.StatusOK, `{"members":[
+				{"id":"a","name":"node1","clientURLs":["http://10.0.0.1:4001","http://10.0.0.1:2379"]},
+				{"id":"b","name":"node2","clientURLs":["http://10.0.0.2:4001"]},
+				{"id":"c","name":"","clientURLs":[]}
+			]}`))
+
+			members, err := runners.NewV2MembersDiscoverer(&fakes.Getter{}, []string{etcdServer.URL()}, time.Minute, fakeClock).Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(Equal([]runners.EtcdMember{
+				{Name: "node1", URL: "http://10.0.0.1:4001"},
+				{Name: "node2", URL: "http://10.0.0.2:4001"},
+			}))
+		})
+
+		It("lists the members again once the refresh interval has passed", func() {
+			etcdServer.RouteToHandler("GET", "/v2/members", ghttp.RespondWith(http.StatusOK, `{"members":[
+				{"id":"a","name":"node1","clientURLs":["http://10.0.0.1:4001"]}
+			]}`))
+
+			discoverer := runners.NewV2MembersDiscoverer(&fakes.Getter{}, []string{etcdServer.URL()}, time.Minute, fakeClock)
+			_, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeClock.Increment(59 * time.Second)
+			_, err = discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(etcdServer.ReceivedRequests()).To(HaveLen(1))
+
+			fakeClock.Increment(time.Second)
+			_, err = discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(etcdServer.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("falls back to the next seed", func() {
+			etcdServer.RouteToHandler("GET", "/v2/members", ghttp.RespondWith(http.StatusOK, `{"members":[
+				{"id":"a","name":"node1","clientURLs":["http://10.0.0.1:4001"]}
+			]}`))
+
+			fakeGetter := &fakes.Getter{}
+			members, err := runners.NewV2MembersDiscoverer(fakeGetter, []string{"http://127.0.0.1:1", etcdServer.URL()}, time.Minute, fakeClock).Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(HaveLen(1))
+		})
+
+		It("skips the seeds being backed off from", func() {
+			etcdServer.RouteToHandler("GET", "/v2/members", ghttp.RespondWith(http.StatusOK, `{"members":[
+				{"id":"a","name":"node1","clientURLs":["http://10.0.0.1:4001"]}
+			]}`))
+
+			fakeGetter := &fakes.Getter{}
+			reachable := func(etcdURL string) bool { return etcdURL != "http://127.0.0.1:1" }
+
+			members, err := runners.NewV2MembersDiscoverer(fakeGetter, []string{"http://127.0.0.1:1", etcdServer.URL()}, time.Minute, fakeClock).Discover(context.Background(), reachable)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(HaveLen(1))
+			Expect(fakeGetter.GetCall.CallCount).To(Equal(1))
+		})
+
+		It("returns an error when every seed is being backed off from", func() {
+			_, err := runners.NewV2MembersDiscoverer(&fakes.Getter{}, []string{etcdServer.URL()}, time.Minute, fakeClock).Discover(context.Background(), func(string) bool { return false })
+			Expect(err).To(MatchError(fmt.Sprintf("failed to list members from any of [%s]: backing off from the member", etcdServer.URL())))
+			Expect(etcdServer.ReceivedRequests()).To(BeEmpty())
+		})
+
+		It("returns an error when no seed answers", func() {
+			fakeGetter := &fakes.Getter{}
+			fakeGetter.GetCall.Returns.Error = fmt.Errorf("connection refused")
+
+			_, err := runners.NewV2MembersDiscoverer(fakeGetter, []string{"http://127.0.0.1:1"}, time.Minute, fakeClock).Discover(context.Background(), everyMember)
+			Expect(err).To(MatchError("failed to list members from any of [http://127.0.0.1:1]: connection refused"))
+		})
+	})
+})
@@ -0,0 +1,79 @@
+package runners
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry/dropsonde/metrics"
+)
+
+// DropsondeSink sends gauges as dropsonde value metrics and counters as
+// counter events to the metron agent.
+type DropsondeSink struct {
+	lock   sync.Mutex
+	totals map[string]uint64
+}
+
+func NewDropsondeSink() *DropsondeSink {
+	return &DropsondeSink{
+		totals: map[string]uint64{},
+	}
+}
+
+// Send sends every metric of the context, even when some of them fail, and
+// returns their errors.
+func (sink *DropsondeSink) Send(context instrumentation.Context) error {
+	var errs []error
+
+	for _, metric := range flattenSummaries(context.Metrics) {
+		name := taggedMetricName(metric)
+
+		var err error
+		if metric.Kind == instrumentation.Counter {
+			total := uint64(convertToFloat64(metric.Value))
+			err = metrics.AddToCounter(name, sink.counterDelta(context.Name+"."+name, total))
+		} else {
+			err = metrics.SendValue(name, convertToFloat64(metric.Value), GetMetricUnit(metric))
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// counterDelta returns how much a counter grew since it was last sent.
+// Dropsonde counter events carry a total kept by the sender, so adding the
+// whole etcd total the first time, and again after the member restarted,
+// keeps it in step with etcd's.
+func (sink *DropsondeSink) counterDelta(key string, total uint64) uint64 {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	previous, found := sink.totals[key]
+	sink.totals[key] = total
+
+	if !found || total < previous {
+		return total
+	}
+
+	return total - previous
+}
+
+// taggedMetricName appends the metric's tag values, ordered by tag name, to
+// its name. Dropsonde value metrics cannot carry tags, so without this all
+// metrics sharing a name (e.g. the latency of each follower) would be
+// indistinguishable downstream.
+func taggedMetricName(metric instrumentation.Metric) string {
+	parts := []string{metric.Name}
+	for _, key := range sortedTagKeys(metric.Tags) {
+		parts = append(parts, fmt.Sprint(metric.Tags[key]))
+	}
+
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,79 @@
+package runners_test
+
+import (
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+	"github.com/cloudfoundry/dropsonde/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DropsondeSink", func() {
+	var (
+		sender *fake.FakeMetricSender
+		sink   *runners.DropsondeSink
+	)
+
+	storeContext := func(gets uint64) instrumentation.Context {
+		return instrumentation.Context{
+			Name: "store",
+			Metrics: []instrumentation.Metric{
+				{Name: "Watchers", Value: 3},
+				{Name: "GetsSuccess", Value: gets, Kind: instrumentation.Counter},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		sender = fake.NewFakeMetricSender()
+		metrics.Initialize(sender, nil)
+
+		sink = runners.NewDropsondeSink()
+	})
+
+	It("sends gauges as value metrics with their unit", func() {
+		Expect(sink.Send(instrumentation.Context{
+			Name: "server",
+			Metrics: []instrumentation.Metric{
+				{Name: "IsLeader", Value: 1},
+				{Name: "SendingBandwidthRate", Value: 3.0, Unit: instrumentation.BytesPerSecondUnit},
+			},
+		})).To(Succeed())
+
+		Expect(sender.GetValue("IsLeader")).To(Equal(fake.Metric{Value: 1, Unit: runners.MetricUnit}))
+		Expect(sender.GetValue("SendingBandwidthRate")).To(Equal(fake.Metric{Value: 3.0, Unit: instrumentation.BytesPerSecondUnit}))
+	})
+
+	It("keeps the counter events in step with etcd's totals", func() {
+		Expect(sink.Send(storeContext(100))).To(Succeed())
+		Expect(sender.GetCounter("GetsSuccess")).To(Equal(uint64(100)))
+
+		Expect(sink.Send(storeContext(150))).To(Succeed())
+		Expect(sender.GetCounter("GetsSuccess")).To(Equal(uint64(150)))
+
+		By("adding the whole total again after etcd restarted")
+		Expect(sink.Send(storeContext(20))).To(Succeed())
+		Expect(sender.GetCounter("GetsSuccess")).To(Equal(uint64(170)))
+
+		Expect(sender.GetValue("GetsSuccess")).To(Equal(fake.Metric{}))
+	})
+
+	It("sends summaries as a count counter and a sum value metric", func() {
+		Expect(sink.Send(instrumentation.Context{
+			Name: "metrics",
+			Metrics: []instrumentation.Metric{
+				{
+					Name:  "WalFsyncDuration",
+					Value: instrumentation.SummaryValue{Count: 20102, Sum: 56.83011},
+					Kind:  instrumentation.Summary,
+					Unit:  instrumentation.SecondsUnit,
+				},
+			},
+		})).To(Succeed())
+
+		Expect(sender.GetCounter("WalFsyncDurationCount")).To(Equal(uint64(20102)))
+		Expect(sender.GetValue("WalFsyncDurationSum")).To(Equal(fake.Metric{Value: 56.83011, Unit: instrumentation.SecondsUnit}))
+	})
+})
@@ -0,0 +1,79 @@
+package runners
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
+)
+
+// EtcdAPI selects which etcd endpoints the notifier collects metrics from.
+type EtcdAPI string
+
+const (
+	EtcdV2API   EtcdAPI = "v2"
+	EtcdV3API   EtcdAPI = "v3"
+	EtcdBothAPI EtcdAPI = "both"
+	EtcdAutoAPI EtcdAPI = "auto"
+)
+
+// Contexts returns the names of the contexts emitted for the API, starting
+// with the one that reports whether the member knows the leader. Until the
+// API has been detected only the version is expected.
+func (api EtcdAPI) Contexts() []string {
+	switch api {
+	case EtcdV2API:
+		return []string{"server", "store"}
+	case EtcdV3API:
+		return []string{"metrics", "status"}
+	case EtcdBothAPI:
+		return []string{"metrics", "status", "server", "store"}
+	default:
+		return []string{"version"}
+	}
+}
+
+// APIForVersion picks the API to monitor a member running the given version
+// with. Members from 3.0 up to 3.3, or any member of a cluster still running at
+// 2.x, serve both APIs, so both are collected while a cluster is migrated.
+func APIForVersion(version instruments.EtcdVersion) (EtcdAPI, error) {
+	serverMajor, serverMinor, err := parseVersion(version.Server)
+	if err != nil {
+		return "", err
+	}
+
+	if serverMajor < 3 {
+		return EtcdV2API, nil
+	}
+
+	clusterMajor, _, err := parseVersion(version.Cluster)
+	if err == nil && clusterMajor < 3 {
+		return EtcdBothAPI, nil
+	}
+
+	if serverMajor == 3 && serverMinor < 4 {
+		return EtcdBothAPI, nil
+	}
+
+	return EtcdV3API, nil
+}
+
+func parseVersion(version string) (int, int, error) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid etcd version %q", version)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid etcd version %q", version)
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid etcd version %q", version)
+	}
+
+	return major, minor, nil
+}
@@ -0,0 +1,30 @@
+package runners_test
+
+import (
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EtcdAPI", func() {
+	DescribeTable("APIForVersion",
+		func(server, cluster string, expected runners.EtcdAPI) {
+			api, err := runners.APIForVersion(instruments.EtcdVersion{Server: server, Cluster: cluster})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(api).To(Equal(expected))
+		},
+		Entry("an etcd 2 member", "2.3.7", "2.3.0", runners.EtcdV2API),
+		Entry("an etcd 3.3 member", "3.3.25", "3.3.0", runners.EtcdBothAPI),
+		Entry("an etcd 3.4 member of a cluster still running etcd 2", "3.4.13", "2.3.0", runners.EtcdBothAPI),
+		Entry("an etcd 3.4 member", "3.4.13", "3.4.0", runners.EtcdV3API),
+		Entry("an etcd 3.5 member that has not joined a cluster yet", "3.5.10", "not_decided", runners.EtcdV3API),
+	)
+
+	It("rejects versions it cannot parse", func() {
+		_, err := runners.APIForVersion(instruments.EtcdVersion{Server: "etcd"})
+		Expect(err).To(MatchError(`invalid etcd version "etcd"`))
+	})
+})
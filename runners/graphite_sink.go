@@ -0,0 +1,216 @@
+package runners
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+type GraphiteProtocol string
+
+const (
+	GraphitePlaintext GraphiteProtocol = "plaintext"
+	GraphitePickle    GraphiteProtocol = "pickle"
+)
+
+const graphiteTimeout = 5 * time.Second
+
+var graphitePathEscaper = strings.NewReplacer(".", "_", " ", "_", "\n", "_")
+
+type graphiteDatapoint struct {
+	path      string
+	value     float64
+	timestamp int64
+}
+
+// GraphiteSink writes metrics to a carbon relay over TCP. Datapoints are
+// buffered until the sink is flushed, and written in one go. Those that cannot
+// be delivered are kept, up to bufferSize of them, and sent once the
+// connection has been re-established; the oldest are dropped first. Those
+// written whole before a write failed are not sent again.
+type GraphiteSink struct {
+	address    string
+	prefix     string
+	protocol   GraphiteProtocol
+	bufferSize int
+	clock      clock.Clock
+
+	lock   sync.Mutex
+	conn   net.Conn
+	buffer []graphiteDatapoint
+}
+
+func NewGraphiteSink(address, prefix string, protocol GraphiteProtocol, bufferSize int, clock clock.Clock) (*GraphiteSink, error) {
+	if protocol != GraphitePlaintext && protocol != GraphitePickle {
+		return nil, fmt.Errorf("unknown graphite protocol %q", protocol)
+	}
+
+	return &GraphiteSink{
+		address:    address,
+		prefix:     prefix,
+		protocol:   protocol,
+		bufferSize: bufferSize,
+		clock:      clock,
+	}, nil
+}
+
+func (sink *GraphiteSink) Send(context instrumentation.Context) error {
+	timestamp := sink.clock.Now().Unix()
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	for _, metric := range flattenSummaries(context.Metrics) {
+		sink.buffer = append(sink.buffer, graphiteDatapoint{
+			path:      sink.path(context.Name, metric),
+			value:     convertToFloat64(metric.Value),
+			timestamp: timestamp,
+		})
+	}
+
+	if overflow := len(sink.buffer) - sink.bufferSize; overflow > 0 {
+		sink.buffer = append([]graphiteDatapoint{}, sink.buffer[overflow:]...)
+	}
+
+	return nil
+}
+
+func (sink *GraphiteSink) Flush() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if len(sink.buffer) == 0 {
+		return nil
+	}
+
+	if sink.conn == nil {
+		conn, err := net.DialTimeout("tcp", sink.address, graphiteTimeout)
+		if err != nil {
+			return err
+		}
+		sink.conn = conn
+	}
+
+	var payload []byte
+	if sink.protocol == GraphitePickle {
+		payload = encodeGraphitePickle(sink.buffer)
+	} else {
+		payload = encodeGraphitePlaintext(sink.buffer)
+	}
+
+	sink.conn.SetWriteDeadline(time.Now().Add(graphiteTimeout))
+
+	written, err := sink.conn.Write(payload)
+	if err != nil {
+		sink.conn.Close()
+		sink.conn = nil
+		sink.buffer = append([]graphiteDatapoint{}, sink.buffer[sink.delivered(written, len(payload)):]...)
+		return err
+	}
+
+	sink.buffer = nil
+	return nil
+}
+
+// delivered returns how many of the buffered datapoints carbon received whole
+// when only written bytes of the payload could be written, so that they are
+// not sent again. Carbon drops a pickled list it did not receive whole.
+func (sink *GraphiteSink) delivered(written, payloadSize int) int {
+	if written == payloadSize {
+		return len(sink.buffer)
+	}
+
+	if sink.protocol == GraphitePickle {
+		return 0
+	}
+
+	delivered := 0
+	for _, datapoint := range sink.buffer {
+		written -= len(graphitePlaintextLine(datapoint))
+		if written < 0 {
+			break
+		}
+		delivered++
+	}
+
+	return delivered
+}
+
+func (sink *GraphiteSink) path(contextName string, metric instrumentation.Metric) string {
+	parts := []string{}
+	if sink.prefix != "" {
+		parts = append(parts, sink.prefix)
+	}
+
+	parts = append(parts, graphitePathEscaper.Replace(contextName), graphitePathEscaper.Replace(metric.Name))
+
+	for _, key := range sortedTagKeys(metric.Tags) {
+		parts = append(parts, graphitePathEscaper.Replace(fmt.Sprint(metric.Tags[key])))
+	}
+
+	return strings.Join(parts, ".")
+}
+
+func encodeGraphitePlaintext(datapoints []graphiteDatapoint) []byte {
+	buffer := &bytes.Buffer{}
+
+	for _, datapoint := range datapoints {
+		buffer.WriteString(graphitePlaintextLine(datapoint))
+	}
+
+	return buffer.Bytes()
+}
+
+func graphitePlaintextLine(datapoint graphiteDatapoint) string {
+	return fmt.Sprintf(
+		"%s %s %d\n",
+		datapoint.path,
+		strconv.FormatFloat(datapoint.value, 'f', -1, 64),
+		datapoint.timestamp,
+	)
+}
+
+// encodeGraphitePickle encodes the datapoints as the length-prefixed pickle
+// (protocol 2) list of (path, (timestamp, value)) tuples carbon expects.
+func encodeGraphitePickle(datapoints []graphiteDatapoint) []byte {
+	payload := &bytes.Buffer{}
+
+	payload.Write([]byte{0x80, 0x02}) // PROTO 2
+	payload.WriteByte(']')            // EMPTY_LIST
+	payload.WriteByte('(')            // MARK
+
+	for _, datapoint := range datapoints {
+		payload.WriteByte('X') // BINUNICODE
+		binary.Write(payload, binary.LittleEndian, uint32(len(datapoint.path)))
+		payload.WriteString(datapoint.path)
+
+		writePickleFloat(payload, float64(datapoint.timestamp))
+		writePickleFloat(payload, datapoint.value)
+
+		payload.WriteByte(0x86) // TUPLE2 (timestamp, value)
+		payload.WriteByte(0x86) // TUPLE2 (path, (timestamp, value))
+	}
+
+	payload.WriteByte('e') // APPENDS
+	payload.WriteByte('.') // STOP
+
+	message := &bytes.Buffer{}
+	binary.Write(message, binary.BigEndian, uint32(payload.Len()))
+	message.Write(payload.Bytes())
+
+	return message.Bytes()
+}
+
+func writePickleFloat(buffer *bytes.Buffer, value float64) {
+	buffer.WriteByte('G') // BINFLOAT
+	binary.Write(buffer, binary.BigEndian, math.Float64bits(value))
+}
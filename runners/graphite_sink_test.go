@@ -0,0 +1,177 @@
+package runners_test
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GraphiteSink", func() {
+	var (
+		carbon    net.Listener
+		address   string
+		received  chan []byte
+		fakeClock *fakeclock.FakeClock
+		sink      *runners.GraphiteSink
+		protocol  runners.GraphiteProtocol
+	)
+
+	startCarbon := func() {
+		var err error
+		carbon, err = net.Listen("tcp", address)
+		Expect(err).NotTo(HaveOccurred())
+		address = carbon.Addr().String()
+
+		go func(listener net.Listener) {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				go func() {
+					defer conn.Close()
+					buffer := make([]byte, 4096)
+					for {
+						n, err := conn.Read(buffer)
+						if n > 0 {
+							received <- append([]byte{}, buffer[:n]...)
+						}
+						if err != nil {
+							return
+						}
+					}
+				}()
+			}
+		}(carbon)
+	}
+
+	leaderContext := instrumentation.Context{
+		Name: "leader",
+		Metrics: []instrumentation.Metric{
+			{Name: "Followers", Value: 2},
+			{Name: "Latency", Value: 0.25, Tags: map[string]interface{}{"follower": "10.0.0.1"}},
+		},
+	}
+
+	BeforeEach(func() {
+		address = "127.0.0.1:0"
+		received = make(chan []byte, 100)
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1475280000, 0))
+		protocol = runners.GraphitePlaintext
+		startCarbon()
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		sink, err = runners.NewGraphiteSink(address, "etcd", protocol, 3, fakeClock)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		carbon.Close()
+	})
+
+	readLines := func(count int) []string {
+		data := ""
+		for strings.Count(data, "\n") < count {
+			var chunk []byte
+			Eventually(received).Should(Receive(&chunk))
+			data += string(chunk)
+		}
+		return strings.SplitAfter(data, "\n")[:count]
+	}
+
+	Context("with the plaintext protocol", func() {
+		It("writes each metric as a path, value and timestamp once flushed", func() {
+			err := sink.Send(leaderContext)
+			Expect(err).NotTo(HaveOccurred())
+			Consistently(received).ShouldNot(Receive())
+
+			err = sink.Flush()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(readLines(2)).To(Equal([]string{
+				"etcd.leader.Followers 2 1475280000\n",
+				"etcd.leader.Latency.10_0_0_1 0.25 1475280000\n",
+			}))
+		})
+
+		Context("when the carbon relay is down", func() {
+			JustBeforeEach(func() {
+				carbon.Close()
+			})
+
+			It("buffers a bounded number of datapoints and sends them once it is back", func() {
+				err := sink.Send(leaderContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sink.Flush()).To(HaveOccurred())
+
+				fakeClock.Increment(time.Minute)
+				err = sink.Send(instrumentation.Context{
+					Name:    "server",
+					Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1}},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sink.Flush()).To(HaveOccurred())
+
+				startCarbon()
+
+				fakeClock.Increment(time.Minute)
+				err = sink.Send(instrumentation.Context{
+					Name:    "store",
+					Metrics: []instrumentation.Metric{{Name: "Watchers", Value: uint64(12)}},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sink.Flush()).To(Succeed())
+
+				Expect(readLines(3)).To(Equal([]string{
+					"etcd.leader.Latency.10_0_0_1 0.25 1475280000\n",
+					"etcd.server.IsLeader 1 1475280060\n",
+					"etcd.store.Watchers 12 1475280120\n",
+				}))
+			})
+		})
+	})
+
+	Context("with the pickle protocol", func() {
+		BeforeEach(func() {
+			protocol = runners.GraphitePickle
+		})
+
+		It("writes a length-prefixed pickled list of datapoints", func() {
+			err := sink.Send(instrumentation.Context{
+				Name:    "server",
+				Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sink.Flush()).To(Succeed())
+
+			var payload []byte
+			Eventually(received).Should(Receive(&payload))
+
+			path := "etcd.server.IsLeader"
+			expected := []byte{0x80, 0x02, ']', '('}
+			expected = append(expected, 'X', byte(len(path)), 0, 0, 0)
+			expected = append(expected, path...)
+			expected = append(expected, 'G', 0x41, 0xd5, 0xfb, 0xbf, 0x20, 0x00, 0x00, 0x00) // 1475280000.0
+			expected = append(expected, 'G', 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00) // 1.0
+			expected = append(expected, 0x86, 0x86, 'e', '.')
+
+			Expect(payload[:4]).To(Equal([]byte{0, 0, 0, byte(len(expected))}))
+			Expect(payload[4:]).To(Equal(expected))
+		})
+	})
+
+	It("rejects unknown protocols", func() {
+		_, err := runners.NewGraphiteSink(address, "etcd", "udp", 3, fakeClock)
+		Expect(err).To(MatchError(`unknown graphite protocol "udp"`))
+	})
+})
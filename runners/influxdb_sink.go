@@ -0,0 +1,212 @@
+package runners
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/clock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+var (
+	influxDBMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	influxDBKeyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+type poster interface {
+	Post(url string, bodyType string, body io.Reader) (*http.Response, error)
+}
+
+// influxDBPendingBatches bounds how many batches of lines that could not be
+// written are kept for the next flush; the oldest are dropped beyond that.
+const influxDBPendingBatches = 10
+
+// InfluxDBSink writes metrics in the InfluxDB line protocol, either over UDP
+// or to the HTTP /write endpoint. Lines are batched until batchSize of them
+// have accumulated or the sink is flushed. Lines whose write failed are kept,
+// up to influxDBPendingBatches batches of them, and sent with the next flush.
+type InfluxDBSink struct {
+	writeURL  string
+	udpConn   net.Conn
+	poster    poster
+	batchSize int
+	clock     clock.Clock
+
+	lock  sync.Mutex
+	lines []string
+}
+
+// NewInfluxDBSink creates a sink for the InfluxDB at address, which is either
+// an http(s):// URL of the server or a udp://host:port listener.
+func NewInfluxDBSink(address, database string, batchSize int, poster poster, clock clock.Clock) (*InfluxDBSink, error) {
+	influxURL, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &InfluxDBSink{
+		poster:    poster,
+		batchSize: batchSize,
+		clock:     clock,
+	}
+
+	switch influxURL.Scheme {
+	case "udp":
+		sink.udpConn, err = net.Dial("udp", influxURL.Host)
+		if err != nil {
+			return nil, err
+		}
+	case "http", "https":
+		influxURL.Path = strings.TrimSuffix(influxURL.Path, "/") + "/write"
+		influxURL.RawQuery = url.Values{"db": {database}, "precision": {"ns"}}.Encode()
+		sink.writeURL = influxURL.String()
+	default:
+		return nil, fmt.Errorf("unsupported influxdb scheme %q", influxURL.Scheme)
+	}
+
+	return sink, nil
+}
+
+func (sink *InfluxDBSink) Send(context instrumentation.Context) error {
+	lines := influxDBLines(context, sink.clock.Now().UnixNano())
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	sink.lines = append(sink.lines, lines...)
+	if len(sink.lines) < sink.batchSize {
+		return nil
+	}
+
+	return sink.flush()
+}
+
+func (sink *InfluxDBSink) Flush() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	return sink.flush()
+}
+
+func (sink *InfluxDBSink) flush() error {
+	if len(sink.lines) == 0 {
+		return nil
+	}
+
+	var unsent []string
+	var err error
+	if sink.udpConn != nil {
+		unsent, err = sink.writeUDP(sink.lines)
+	} else {
+		unsent, err = sink.writeHTTP(sink.lines)
+	}
+
+	if overflow := len(unsent) - influxDBPendingBatches*sink.batchSize; overflow > 0 {
+		unsent = unsent[overflow:]
+	}
+	sink.lines = append([]string{}, unsent...)
+
+	return err
+}
+
+// writeUDP sends the lines in as few datagrams as fit them, carrying on past
+// a failed datagram, and returns the lines of those that could not be sent.
+func (sink *InfluxDBSink) writeUDP(lines []string) ([]string, error) {
+	var unsent []string
+	var errs []error
+
+	datagram := &bytes.Buffer{}
+	start := 0
+
+	send := func(end int) {
+		_, err := sink.udpConn.Write(datagram.Bytes())
+		if err != nil {
+			unsent = append(unsent, lines[start:end]...)
+			errs = append(errs, err)
+		}
+		datagram.Reset()
+		start = end
+	}
+
+	for i, line := range lines {
+		if datagram.Len() > 0 && datagram.Len()+len(line) > maxDatagramSize {
+			send(i)
+		}
+		datagram.WriteString(line)
+	}
+	send(len(lines))
+
+	return unsent, errors.Join(errs...)
+}
+
+// writeHTTP posts the lines in one request and returns them all when they
+// are worth retrying: the request failed, or the server had a problem. A
+// request rejected as bad is not retried.
+func (sink *InfluxDBSink) writeHTTP(lines []string) ([]string, error) {
+	body := strings.NewReader(strings.Join(lines, ""))
+
+	resp, err := sink.poster.Post(sink.writeURL, "text/plain; charset=utf-8", body)
+	if err != nil {
+		return lines, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		err := fmt.Errorf("influxdb write failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return lines, err
+		}
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// influxDBLines turns a context into one line per distinct tag set, with the
+// context as the measurement and each metric as a field.
+func influxDBLines(context instrumentation.Context, timestamp int64) []string {
+	fields := map[string][]string{}
+	series := []string{}
+
+	measurement := influxDBMeasurementEscaper.Replace(context.Name)
+
+	for _, metric := range flattenSummaries(context.Metrics) {
+		key := measurement
+		for _, tag := range sortedTagKeys(metric.Tags) {
+			if fmt.Sprint(metric.Tags[tag]) == "" {
+				// the line protocol has no empty tag values
+				continue
+			}
+			key += "," + influxDBKeyEscaper.Replace(tag) + "=" + influxDBKeyEscaper.Replace(fmt.Sprint(metric.Tags[tag]))
+		}
+
+		if _, found := fields[key]; !found {
+			series = append(series, key)
+		}
+
+		fields[key] = append(fields[key], fmt.Sprintf(
+			"%s=%s",
+			influxDBKeyEscaper.Replace(metric.Name),
+			strconv.FormatFloat(convertToFloat64(metric.Value), 'f', -1, 64),
+		))
+	}
+
+	lines := make([]string, 0, len(series))
+	for _, key := range series {
+		sort.Strings(fields[key])
+		lines = append(lines, fmt.Sprintf("%s %s %d\n", key, strings.Join(fields[key], ","), timestamp))
+	}
+
+	return lines
+}
@@ -0,0 +1,214 @@
+package runners_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+	"github.com/onsi/gomega/ghttp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InfluxDBSink", func() {
+	var (
+		fakeClock *fakeclock.FakeClock
+		sink      *runners.InfluxDBSink
+	)
+
+	leaderContext := instrumentation.Context{
+		Name: "leader",
+		Metrics: []instrumentation.Metric{
+			{Name: "Followers", Value: 2},
+			{Name: "Latency", Value: 0.25, Tags: map[string]interface{}{"follower": "node 1"}},
+			{Name: "Latency", Value: 0.5, Tags: map[string]interface{}{"follower": "node2"}},
+		},
+	}
+
+	serverContext := instrumentation.Context{
+		Name: "server",
+		Metrics: []instrumentation.Metric{
+			{Name: "IsLeader", Value: 1},
+			{Name: "SentAppendRequests", Value: uint64(4321)},
+		},
+	}
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Unix(0, 1475280000000000000))
+	})
+
+	Context("over HTTP", func() {
+		var influxdb *ghttp.Server
+
+		BeforeEach(func() {
+			influxdb = ghttp.NewServer()
+
+			var err error
+			sink, err = runners.NewInfluxDBSink(influxdb.URL(), "etcd", 100, http.DefaultClient, fakeClock)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			influxdb.Close()
+		})
+
+		It("writes the batched lines to /write when flushed", func() {
+			influxdb.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/write", "db=etcd&precision=ns"),
+				ghttp.VerifyBody([]byte(strings.Join([]string{
+					"leader Followers=2 1475280000000000000\n",
+					`leader,follower=node\ 1 Latency=0.25 1475280000000000000` + "\n",
+					"leader,follower=node2 Latency=0.5 1475280000000000000\n",
+					"server IsLeader=1,SentAppendRequests=4321 1475280000000000000\n",
+				}, ""))),
+				ghttp.RespondWith(http.StatusNoContent, nil),
+			))
+
+			Expect(sink.Send(leaderContext)).To(Succeed())
+			Expect(sink.Send(serverContext)).To(Succeed())
+			Expect(influxdb.ReceivedRequests()).To(BeEmpty())
+
+			Expect(sink.Flush()).To(Succeed())
+			Expect(influxdb.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		It("writes as soon as a batch is full", func() {
+			var err error
+			sink, err = runners.NewInfluxDBSink(influxdb.URL(), "etcd", 3, http.DefaultClient, fakeClock)
+			Expect(err).NotTo(HaveOccurred())
+
+			influxdb.AppendHandlers(ghttp.RespondWith(http.StatusNoContent, nil))
+
+			Expect(sink.Send(serverContext)).To(Succeed())
+			Expect(influxdb.ReceivedRequests()).To(BeEmpty())
+
+			Expect(sink.Send(leaderContext)).To(Succeed())
+			Expect(influxdb.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		It("does not write anything when there is nothing to flush", func() {
+			Expect(sink.Flush()).To(Succeed())
+			Expect(influxdb.ReceivedRequests()).To(BeEmpty())
+		})
+
+		It("returns an error when the write is rejected", func() {
+			influxdb.AppendHandlers(ghttp.RespondWith(http.StatusNotFound, `{"error":"database not found: \"etcd\""}`))
+
+			Expect(sink.Send(serverContext)).To(Succeed())
+			Expect(sink.Flush()).To(MatchError(`influxdb write failed with status 404: {"error":"database not found: \"etcd\""}`))
+		})
+
+		It("does not write rejected lines again", func() {
+			influxdb.AppendHandlers(ghttp.RespondWith(http.StatusBadRequest, `{"error":"unable to parse"}`))
+
+			Expect(sink.Send(serverContext)).To(Succeed())
+			Expect(sink.Flush()).NotTo(Succeed())
+
+			Expect(sink.Flush()).To(Succeed())
+			Expect(influxdb.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		It("writes the lines again with the next flush when the server fails", func() {
+			influxdb.AppendHandlers(
+				ghttp.RespondWith(http.StatusServiceUnavailable, "timeout"),
+				ghttp.CombineHandlers(
+					ghttp.VerifyBody([]byte(
+						"server IsLeader=1,SentAppendRequests=4321 1475280000000000000\n"+
+							"server IsLeader=1,SentAppendRequests=4321 1475280001000000000\n",
+					)),
+					ghttp.RespondWith(http.StatusNoContent, nil),
+				),
+			)
+
+			Expect(sink.Send(serverContext)).To(Succeed())
+			Expect(sink.Flush()).To(MatchError("influxdb write failed with status 503: timeout"))
+
+			fakeClock.Increment(time.Second)
+			Expect(sink.Send(serverContext)).To(Succeed())
+			Expect(sink.Flush()).To(Succeed())
+
+			Expect(influxdb.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("keeps a bounded number of the lines that could not be written", func() {
+			var err error
+			sink, err = runners.NewInfluxDBSink(influxdb.URL(), "etcd", 1, http.DefaultClient, fakeClock)
+			Expect(err).NotTo(HaveOccurred())
+
+			influxdb.AllowUnhandledRequests = true
+			influxdb.UnhandledRequestStatusCode = http.StatusInternalServerError
+
+			for i := 0; i < 15; i++ {
+				fakeClock.Increment(time.Second)
+				Expect(sink.Send(serverContext)).NotTo(Succeed())
+			}
+
+			var body []byte
+			influxdb.AllowUnhandledRequests = false
+			influxdb.AppendHandlers(ghttp.CombineHandlers(
+				func(w http.ResponseWriter, r *http.Request) {
+					body, _ = ioutil.ReadAll(r.Body)
+				},
+				ghttp.RespondWith(http.StatusNoContent, nil),
+			))
+			Expect(sink.Flush()).To(Succeed())
+
+			Expect(strings.Count(string(body), "\n")).To(Equal(10))
+		})
+
+		It("leaves out tags with empty values", func() {
+			influxdb.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyBody([]byte("store,member=node1 Watchers=3 1475280000000000000\n")),
+				ghttp.RespondWith(http.StatusNoContent, nil),
+			))
+
+			Expect(sink.Send(instrumentation.Context{
+				Name: "store",
+				Metrics: []instrumentation.Metric{
+					{Name: "Watchers", Value: 3, Tags: map[string]interface{}{"member": "node1", "version": ""}},
+				},
+			})).To(Succeed())
+			Expect(sink.Flush()).To(Succeed())
+		})
+	})
+
+	Context("over UDP", func() {
+		var influxdb net.PacketConn
+
+		BeforeEach(func() {
+			var err error
+			influxdb, err = net.ListenPacket("udp4", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+
+			sink, err = runners.NewInfluxDBSink("udp://"+influxdb.LocalAddr().String(), "etcd", 100, http.DefaultClient, fakeClock)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			influxdb.Close()
+		})
+
+		It("sends the batched lines as datagrams when flushed", func() {
+			Expect(sink.Send(serverContext)).To(Succeed())
+			Expect(sink.Flush()).To(Succeed())
+
+			buffer := make([]byte, 65536)
+			influxdb.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := influxdb.ReadFrom(buffer)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(string(buffer[:n])).To(Equal("server IsLeader=1,SentAppendRequests=4321 1475280000000000000\n"))
+		})
+	})
+
+	It("rejects unsupported schemes", func() {
+		_, err := runners.NewInfluxDBSink("tcp://127.0.0.1:8086", "etcd", 100, http.DefaultClient, fakeClock)
+		Expect(err).To(MatchError(`unsupported influxdb scheme "tcp"`))
+	})
+})
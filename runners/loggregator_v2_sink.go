@@ -0,0 +1,95 @@
+package runners
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+type envelopeEmitter interface {
+	EmitGauge(opts ...loggregator.EmitGaugeOption)
+	EmitCounter(name string, opts ...loggregator.EmitCounterOption)
+}
+
+// LoggregatorV2Sink sends counters as Loggregator v2 counter envelopes
+// carrying their total, and every other metric as gauge envelopes. Gauges
+// sharing the same tags are sent together in a single envelope.
+type LoggregatorV2Sink struct {
+	emitter    envelopeEmitter
+	sourceID   string
+	instanceID string
+}
+
+func NewLoggregatorV2Sink(emitter envelopeEmitter, sourceID, instanceID string) *LoggregatorV2Sink {
+	return &LoggregatorV2Sink{
+		emitter:    emitter,
+		sourceID:   sourceID,
+		instanceID: instanceID,
+	}
+}
+
+func (sink *LoggregatorV2Sink) Send(context instrumentation.Context) error {
+	groups := map[string][]instrumentation.Metric{}
+	keys := []string{}
+
+	for _, metric := range flattenSummaries(context.Metrics) {
+		if metric.Kind == instrumentation.Counter {
+			sink.emitter.EmitCounter(
+				metric.Name,
+				loggregator.WithCounterSourceInfo(sink.sourceID, sink.instanceID),
+				loggregator.WithEnvelopeTags(stringTags(metric.Tags)),
+				loggregator.WithTotal(uint64(convertToFloat64(metric.Value))),
+			)
+			continue
+		}
+
+		key := tagsKey(metric.Tags)
+		if _, found := groups[key]; !found {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], metric)
+	}
+
+	for _, key := range keys {
+		metrics := groups[key]
+
+		opts := []loggregator.EmitGaugeOption{
+			loggregator.WithGaugeSourceInfo(sink.sourceID, sink.instanceID),
+			loggregator.WithEnvelopeTags(stringTags(metrics[0].Tags)),
+		}
+
+		for _, metric := range metrics {
+			opts = append(opts, loggregator.WithGaugeValue(
+				metric.Name,
+				convertToFloat64(metric.Value),
+				GetMetricUnit(metric),
+			))
+		}
+
+		sink.emitter.EmitGauge(opts...)
+	}
+
+	return nil
+}
+
+func stringTags(tags map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(tags))
+	for key, value := range tags {
+		result[key] = fmt.Sprint(value)
+	}
+
+	return result
+}
+
+func tagsKey(tags map[string]interface{}) string {
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,217 @@
+package runners_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoggregatorV2Sink", func() {
+	var (
+		certDir    string
+		agent      *fakeIngressServer
+		grpcServer *grpc.Server
+		client     *loggregator.IngressClient
+		sink       *runners.LoggregatorV2Sink
+	)
+
+	BeforeEach(func() {
+		var err error
+		certDir, err = ioutil.TempDir("", "loggregator-certs")
+		Expect(err).NotTo(HaveOccurred())
+
+		caPath, certPath, keyPath := generateCertificates(certDir)
+
+		serverTLSConfig, err := loggregator.NewIngressTLSConfig(caPath, certPath, keyPath)
+		Expect(err).NotTo(HaveOccurred())
+		serverTLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		serverTLSConfig.ClientCAs = serverTLSConfig.RootCAs
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		agent = &fakeIngressServer{envelopes: make(chan *loggregator_v2.Envelope, 100)}
+		grpcServer = grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLSConfig)))
+		loggregator_v2.RegisterIngressServer(grpcServer, agent)
+		go grpcServer.Serve(listener)
+
+		clientTLSConfig, err := loggregator.NewIngressTLSConfig(caPath, certPath, keyPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		client, err = loggregator.NewIngressClient(
+			clientTLSConfig,
+			loggregator.WithAddr(listener.Addr().String()),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		sink = runners.NewLoggregatorV2Sink(client, "etcd-diego", "2")
+	})
+
+	AfterEach(func() {
+		client.CloseSend()
+		grpcServer.Stop()
+		os.RemoveAll(certDir)
+	})
+
+	It("sends gauges sharing the same tags as a single envelope and counters on their own", func() {
+		err := sink.Send(instrumentation.Context{
+			Name: "leader",
+			Metrics: []instrumentation.Metric{
+				{Name: "Followers", Value: 2},
+				{Name: "Latency", Value: 1.5, Tags: map[string]interface{}{"follower": "node1"}},
+				{Name: "Latency", Value: 2.5, Tags: map[string]interface{}{"follower": "node2"}},
+			},
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+
+		err = sink.Send(instrumentation.Context{
+			Name: "server",
+			Metrics: []instrumentation.Metric{
+				{Name: "IsLeader", Value: 1},
+				{Name: "SendingBandwidthRate", Value: 3.0, Unit: instrumentation.BytesPerSecondUnit},
+				{Name: "SentAppendRequests", Value: uint64(4321), Kind: instrumentation.Counter},
+			},
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+
+		var envelopes []*loggregator_v2.Envelope
+		for i := 0; i < 5; i++ {
+			var envelope *loggregator_v2.Envelope
+			Eventually(agent.envelopes).Should(Receive(&envelope))
+			envelopes = append(envelopes, envelope)
+		}
+
+		for _, envelope := range envelopes {
+			Expect(envelope.SourceId).To(Equal("etcd-diego"))
+			Expect(envelope.InstanceId).To(Equal("2"))
+		}
+
+		Expect(envelopes[0].GetGauge().Metrics).To(Equal(map[string]*loggregator_v2.GaugeValue{
+			"Followers": {Value: 2, Unit: runners.MetricUnit},
+		}))
+		Expect(envelopes[0].Tags).To(BeEmpty())
+
+		Expect(envelopes[1].GetGauge().Metrics).To(Equal(map[string]*loggregator_v2.GaugeValue{
+			"Latency": {Value: 1.5, Unit: runners.MetricUnit},
+		}))
+		Expect(envelopes[1].Tags).To(Equal(map[string]string{"follower": "node1"}))
+
+		Expect(envelopes[2].GetGauge().Metrics).To(Equal(map[string]*loggregator_v2.GaugeValue{
+			"Latency": {Value: 2.5, Unit: runners.MetricUnit},
+		}))
+		Expect(envelopes[2].Tags).To(Equal(map[string]string{"follower": "node2"}))
+
+		Expect(envelopes[3].GetCounter().Name).To(Equal("SentAppendRequests"))
+		Expect(envelopes[3].GetCounter().Total).To(Equal(uint64(4321)))
+
+		Expect(envelopes[4].GetGauge().Metrics).To(Equal(map[string]*loggregator_v2.GaugeValue{
+			"IsLeader":             {Value: 1, Unit: runners.MetricUnit},
+			"SendingBandwidthRate": {Value: 3.0, Unit: instrumentation.BytesPerSecondUnit},
+		}))
+	})
+})
+
+type fakeIngressServer struct {
+	envelopes chan *loggregator_v2.Envelope
+}
+
+func (s *fakeIngressServer) Sender(stream loggregator_v2.Ingress_SenderServer) error {
+	for {
+		envelope, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		s.envelopes <- envelope
+	}
+}
+
+func (s *fakeIngressServer) BatchSender(stream loggregator_v2.Ingress_BatchSenderServer) error {
+	for {
+		batch, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		for _, envelope := range batch.Batch {
+			s.envelopes <- envelope
+		}
+	}
+}
+
+func (s *fakeIngressServer) Send(ctx context.Context, batch *loggregator_v2.EnvelopeBatch) (*loggregator_v2.SendResponse, error) {
+	for _, envelope := range batch.Batch {
+		s.envelopes <- envelope
+	}
+	return &loggregator_v2.SendResponse{}, nil
+}
+
+// generateCertificates writes a CA and a certificate signed by it, valid for
+// both the "metron" server name and client authentication, into dir.
+func generateCertificates(dir string) (caPath, certPath, keyPath string) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "testCA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "metron"},
+		DNSNames:     []string{"metron"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+
+	caPath = filepath.Join(dir, "ca.crt")
+	certPath = filepath.Join(dir, "client.crt")
+	keyPath = filepath.Join(dir, "client.key")
+
+	writePEM(caPath, "CERTIFICATE", caDER)
+	writePEM(certPath, "CERTIFICATE", certDER)
+	writePEM(keyPath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+
+	return caPath, certPath, keyPath
+}
+
+func writePEM(path, blockType string, bytes []byte) {
+	err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0600)
+	Expect(err).NotTo(HaveOccurred())
+}
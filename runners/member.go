@@ -0,0 +1,386 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
+	"google.golang.org/grpc"
+)
+
+// duplicateV2Metrics are the server metrics the v3 metrics endpoint reports
+// too. When both APIs are collected they are only sent from the latter, as
+// sinks that leave the context out of the series name would see them twice.
+var duplicateV2Metrics = map[string]bool{"IsLeader": true, "HasLeader": true, "LeaderChanges": true}
+
+// member collects the metrics of a single etcd member. With EtcdAutoAPI the
+// API is picked from the member's version, which is detected again whenever
+// the member could not be reached. The instruments due according to the
+// scheduler are collected concurrently. Detecting the version and scraping
+// share the deadline of the report interval, given by ctx. Once the breaker
+// opens the member is only probed until it answers again.
+type member struct {
+	EtcdMember
+
+	getter         getter
+	conn           *grpc.ClientConn
+	api            EtcdAPI
+	redirectPolicy instruments.RedirectPolicy
+	interval       time.Duration
+	scheduler      *scheduler
+	breaker        *breaker
+	logger         lager.Logger
+
+	version        *instruments.Version
+	versionScraper *scraper
+	scrapers       map[EtcdAPI][]*scraper
+	scraped        []*scraper
+	redetect       bool
+	lock           sync.RWMutex
+	detectedAPI    EtcdAPI
+}
+
+func newMember(
+	etcdMember EtcdMember,
+	getter getter,
+	conn *grpc.ClientConn,
+	api EtcdAPI,
+	redirectPolicy instruments.RedirectPolicy,
+	interval time.Duration,
+	scheduler *scheduler,
+	breaker *breaker,
+	logger lager.Logger,
+) *member {
+	m := &member{
+		EtcdMember:     etcdMember,
+		getter:         getter,
+		conn:           conn,
+		api:            api,
+		redirectPolicy: redirectPolicy,
+		interval:       interval,
+		scheduler:      scheduler,
+		breaker:        breaker,
+		logger:         logger,
+		version:        instruments.NewVersion(getter, etcdMember.URL, logger),
+		redetect:       true,
+	}
+	m.versionScraper = newScraper("version", instrumentation.NewEmitCollector("version", m.version))
+	m.scrapers = m.newScrapers()
+
+	return m
+}
+
+// healthContexts returns the contexts the member's health is judged by for
+// the API currently being collected, leaving out those it has no instrument
+// for, such as the status when the member could not be dialled.
+func (m *member) healthContexts() []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	api := m.currentAPI()
+
+	names := map[string]bool{m.versionScraper.name: true}
+	for _, s := range m.scrapers[api] {
+		names[s.name] = true
+	}
+
+	contexts := []string{}
+	for _, name := range api.Contexts() {
+		if names[name] {
+			contexts = append(contexts, name)
+		}
+	}
+
+	return contexts
+}
+
+func (m *member) currentAPI() EtcdAPI {
+	if m.api != EtcdAutoAPI {
+		return m.api
+	}
+
+	return m.detectedAPI
+}
+
+// detectVersion returns the error of asking the member for its version, which
+// tells that it could not be reached. A member that answers without a version
+// that can be made sense of is monitored through the v2 API, until its v2
+// stats can no longer be collected.
+func (m *member) detectVersion(ctx context.Context) error {
+	version, err := m.version.Detect(ctx)
+	if err != nil && !errors.Is(err, instruments.ErrUnknownVersion) {
+		m.logger.Error("failed-to-detect-etcd-version", err)
+		return err
+	}
+
+	m.redetect = false
+
+	if m.api != EtcdAutoAPI {
+		if err != nil {
+			m.logger.Error("failed-to-detect-etcd-version", err)
+		}
+		return nil
+	}
+
+	api := EtcdV2API
+	if err == nil {
+		api, err = APIForVersion(version)
+	}
+
+	if err != nil {
+		m.logger.Error("failed-to-detect-etcd-version", err, lager.Data{"fallback-api": EtcdV2API})
+		api = EtcdV2API
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if api != m.detectedAPI {
+		m.logger.Info("detected-etcd-api", lager.Data{
+			"etcdserver":  version.Server,
+			"etcdcluster": version.Cluster,
+			"api":         api,
+		})
+	}
+
+	m.detectedAPI = api
+	return nil
+}
+
+// newScrapers creates the instruments of each API once, so that the state
+// they keep between scrapes, such as the last leader seen, is not lost.
+func (m *member) newScrapers() map[EtcdAPI][]*scraper {
+	leader := newScraper("leader", instrumentation.NewEmitCollector("leader", instruments.NewLeader(m.getter, m.URL, m.redirectPolicy, m.logger)))
+	server := newScraper("server", instrumentation.NewEmitCollector("server", instruments.NewServer(m.getter, m.URL, m.logger)))
+
+	v2Scrapers := []*scraper{
+		leader,
+		server,
+		newScraper("store", instrumentation.NewEmitCollector("store", instruments.NewStore(m.getter, m.URL, true, m.logger))),
+	}
+
+	v3Scrapers := []*scraper{
+		newScraper("metrics", instruments.NewMetrics(m.getter, m.URL)),
+	}
+
+	// the raft index and term are left to the status instrument when both are
+	// collected
+	bothScrapers := v2Scrapers
+	if m.conn != nil {
+		v3Scrapers = append(v3Scrapers, newScraper("status", instruments.NewStatus(m.conn, m.interval)))
+
+		bothScrapers = []*scraper{
+			leader,
+			server,
+			newScraper("store", instrumentation.NewEmitCollector("store", instruments.NewStore(m.getter, m.URL, false, m.logger))),
+		}
+	}
+
+	return map[EtcdAPI][]*scraper{
+		EtcdV2API:   v2Scrapers,
+		EtcdV3API:   v3Scrapers,
+		EtcdBothAPI: append(append([]*scraper{}, bothScrapers...), v3Scrapers...),
+	}
+}
+
+// collect sends each context of the API currently being collected whose
+// instrument is due as soon as it is collected, starting with the member's
+// version, and then whether the member could be reached. While the breaker is
+// open only the latter is sent. send is called concurrently.
+func (m *member) collect(ctx context.Context, send func(instrumentation.Context)) {
+	if m.breaker.open && !m.probe(ctx) {
+		send(m.tag(endpointContext(false)))
+		return
+	}
+
+	var detectErr error
+	if m.redetect {
+		detectErr = m.detectVersion(ctx)
+	}
+
+	m.lock.RLock()
+	api := m.currentAPI()
+	m.lock.RUnlock()
+
+	m.scraped = append([]*scraper{m.versionScraper}, m.scrapers[api]...)
+
+	now := time.Now()
+	scrapers := []*scraper{}
+	for _, s := range m.scraped {
+		if m.scheduler.due(s, now) {
+			scrapers = append(scrapers, s)
+		}
+	}
+
+	contexts := make([]instrumentation.Context, len(scrapers))
+	errs := make([]error, len(scrapers))
+
+	wg := sync.WaitGroup{}
+	for i, s := range scrapers {
+		wg.Add(1)
+		go func(i int, s *scraper) {
+			defer wg.Done()
+
+			var err error
+			contexts[i], err = s.scrape(ctx)
+			errs[i] = err
+			if api == EtcdBothAPI && contexts[i].Name == "server" {
+				contexts[i] = withoutMetrics(contexts[i], duplicateV2Metrics)
+			}
+			// instruments that emit log their own failures, and scrapes cancelled
+			// by shutting down are not worth logging
+			if err != nil && !errors.Is(err, instrumentation.ErrNoMetrics) && !shuttingDown(ctx) {
+				m.logger.Error("failed-to-scrape-instrument", err, lager.Data{
+					"instrument":           s.name,
+					"consecutive-failures": s.failures,
+				})
+			}
+
+			send(m.tag(contexts[i]))
+		}(i, s)
+	}
+	wg.Wait()
+
+	for _, collected := range contexts {
+		// when the member stops reporting whether it knows the leader it may be
+		// restarting, possibly with a different version
+		if collected.Name == api.Contexts()[0] && len(collected.Metrics) == 0 {
+			m.redetect = true
+		}
+	}
+
+	if !shuttingDown(ctx) {
+		m.recordReachability(detectErr, scrapers, errs, now)
+	}
+
+	send(m.tag(endpointContext(!m.breaker.open)))
+}
+
+// recordReachability counts the member as reached when any of the scrapes of
+// its endpoints succeeded, and as unreachable when they, or detecting its
+// version, failed. The version scrape only reports the version last detected,
+// so it does not count.
+func (m *member) recordReachability(detectErr error, scrapers []*scraper, errs []error, now time.Time) {
+	attempted := detectErr != nil
+	lastErr := detectErr
+
+	for i, s := range scrapers {
+		if s == m.versionScraper {
+			continue
+		}
+
+		if errs[i] == nil {
+			m.breaker.succeed()
+			return
+		}
+
+		attempted = true
+		lastErr = errs[i]
+	}
+
+	if attempted && m.breaker.fail(now) {
+		m.logger.Error("etcd-unreachable", lastErr, lager.Data{
+			"consecutive-failures": m.breaker.failures,
+			"retry-in":             m.breaker.backoff.String(),
+		})
+	}
+}
+
+// probe asks an unreachable member for its version once the backoff is over,
+// and closes the breaker when it answers.
+func (m *member) probe(ctx context.Context) bool {
+	now := time.Now()
+	if !m.breaker.allow(now) {
+		return false
+	}
+
+	_, err := m.version.Detect(ctx)
+	if err != nil {
+		m.breaker.fail(now)
+		m.logger.Debug("etcd-still-unreachable", lager.Data{
+			"error":    err.Error(),
+			"retry-in": m.breaker.backoff.String(),
+		})
+		return false
+	}
+
+	m.breaker.succeed()
+	m.logger.Info("etcd-reachable-again")
+
+	// it may have been upgraded while it could not be reached
+	m.redetect = true
+	return true
+}
+
+// shuttingDown tells a scrape cancelled by shutting down apart from one that
+// ran out of time.
+func shuttingDown(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// endpointContext reports whether the member could be reached.
+func endpointContext(reachable bool) instrumentation.Context {
+	value := 0
+	if reachable {
+		value = 1
+	}
+
+	return instrumentation.Context{
+		Name: "endpoint",
+		Metrics: []instrumentation.Metric{
+			{Name: "EtcdReachable", Value: value},
+		},
+	}
+}
+
+func withoutMetrics(context instrumentation.Context, names map[string]bool) instrumentation.Context {
+	metrics := make([]instrumentation.Metric, 0, len(context.Metrics))
+	for _, metric := range context.Metrics {
+		if !names[metric.Name] {
+			metrics = append(metrics, metric)
+		}
+	}
+	context.Metrics = metrics
+
+	return context
+}
+
+// rename changes the name the member's metrics are tagged with, once it has
+// reported its name.
+func (m *member) rename(name string) {
+	m.Name = name
+}
+
+// tag marks the context and each of its metrics with the member's name when
+// monitoring a whole cluster.
+func (m *member) tag(context instrumentation.Context) instrumentation.Context {
+	if m.Name == "" {
+		return context
+	}
+
+	context.Member = m.Name
+
+	metrics := make([]instrumentation.Metric, len(context.Metrics))
+	for i, metric := range context.Metrics {
+		tags := map[string]interface{}{"member": m.Name}
+		for key, value := range metric.Tags {
+			tags[key] = value
+		}
+
+		metric.Tags = tags
+		metrics[i] = metric
+	}
+	context.Metrics = metrics
+
+	return context
+}
+
+func (m *member) close() {
+	if m.conn != nil {
+		m.conn.Close()
+	}
+}
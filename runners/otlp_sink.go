@@ -0,0 +1,331 @@
+package runners
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+type OTLPEncoding string
+
+const (
+	OTLPProtobuf OTLPEncoding = "protobuf"
+	OTLPJSON     OTLPEncoding = "json"
+)
+
+const otlpScopeName = "etcd-metrics-server"
+
+var otlpUnits = map[string]string{
+	MetricUnit:                            "1",
+	instrumentation.BytesUnit:             "By",
+	instrumentation.SecondsUnit:           "s",
+	instrumentation.MillisecondsUnit:      "ms",
+	instrumentation.BytesPerSecondUnit:    "By/s",
+	instrumentation.RequestsPerSecondUnit: "{request}/s",
+}
+
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// OTLPSink exports metrics to an OpenTelemetry collector over OTLP/HTTP.
+// Counters are exported as cumulative monotonic sums and everything else as
+// gauges. Metrics are batched into a single export request per flush, with a
+// resource for each member they were collected from. Contexts that are not
+// tagged with a member, when a single member is monitored, are attributed to
+// the name memberName returns when they are exported.
+type OTLPSink struct {
+	endpoint   string
+	encoding   OTLPEncoding
+	jobName    string
+	index      string
+	memberName func() string
+	client     httpDoer
+	clock      clock.Clock
+	startTime  time.Time
+
+	lock      sync.Mutex
+	resources []*otlpResource
+	series    map[string]otlpSeries
+}
+
+// otlpSeries tracks a cumulative series, so that it starts over when it went
+// down because the etcd member restarted.
+type otlpSeries struct {
+	start time.Time
+	value float64
+	at    time.Time
+}
+
+// otlpResource holds the metrics of a member in the order they were first
+// sent.
+type otlpResource struct {
+	member  string
+	names   []string
+	metrics map[string]*metricspb.Metric
+}
+
+func NewOTLPSink(
+	endpoint string,
+	encoding OTLPEncoding,
+	jobName string,
+	index string,
+	memberName func() string,
+	client httpDoer,
+	clock clock.Clock,
+) (*OTLPSink, error) {
+	if encoding != OTLPProtobuf && encoding != OTLPJSON {
+		return nil, fmt.Errorf("unknown otlp encoding %q", encoding)
+	}
+
+	return &OTLPSink{
+		endpoint:   endpoint,
+		encoding:   encoding,
+		jobName:    jobName,
+		index:      index,
+		memberName: memberName,
+		client:     client,
+		clock:      clock,
+		startTime:  clock.Now(),
+		series:     map[string]otlpSeries{},
+	}, nil
+}
+
+func (sink *OTLPSink) Send(context instrumentation.Context) error {
+	now := sink.clock.Now()
+	timestamp := uint64(now.UnixNano())
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	resource := sink.resource(context.Member)
+
+	for _, metric := range context.Metrics {
+		name := "etcd." + context.Name + "." + metric.Name
+
+		otlpMetric, found := resource.metrics[name]
+		if !found {
+			otlpMetric = sink.newMetric(name, metric)
+			resource.metrics[name] = otlpMetric
+			resource.names = append(resource.names, name)
+		}
+
+		if summary := otlpMetric.GetSummary(); summary != nil {
+			value, ok := metric.Value.(instrumentation.SummaryValue)
+			if ok {
+				summary.DataPoints = append(summary.DataPoints, &metricspb.SummaryDataPoint{
+					Attributes:        otlpAttributes(metric.Tags),
+					StartTimeUnixNano: sink.start(counterKey(context, metric), float64(value.Count), now),
+					TimeUnixNano:      timestamp,
+					Count:             value.Count,
+					Sum:               value.Sum,
+				})
+			}
+			continue
+		}
+
+		dataPoint := &metricspb.NumberDataPoint{
+			Attributes:   otlpAttributes(metric.Tags),
+			TimeUnixNano: timestamp,
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: convertToFloat64(metric.Value)},
+		}
+
+		if sum := otlpMetric.GetSum(); sum != nil {
+			dataPoint.StartTimeUnixNano = sink.start(counterKey(context, metric), dataPoint.GetAsDouble(), now)
+			sum.DataPoints = append(sum.DataPoints, dataPoint)
+		} else {
+			gauge := otlpMetric.GetGauge()
+			gauge.DataPoints = append(gauge.DataPoints, dataPoint)
+		}
+	}
+
+	return nil
+}
+
+func (sink *OTLPSink) Flush() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if len(sink.resources) == 0 {
+		return nil
+	}
+
+	request := &colmetricspb.ExportMetricsServiceRequest{}
+	for _, resource := range sink.resources {
+		member := resource.member
+		if member == "" {
+			member = sink.memberName()
+		}
+
+		metrics := make([]*metricspb.Metric, 0, len(resource.names))
+		for _, name := range resource.names {
+			metrics = append(metrics, resource.metrics[name])
+		}
+
+		request.ResourceMetrics = append(request.ResourceMetrics, &metricspb.ResourceMetrics{
+			Resource: &resourcepb.Resource{
+				Attributes: sink.resourceAttributes(member),
+			},
+			ScopeMetrics: []*metricspb.ScopeMetrics{
+				{
+					Scope:   &commonpb.InstrumentationScope{Name: otlpScopeName},
+					Metrics: metrics,
+				},
+			},
+		})
+	}
+
+	sink.resources = nil
+
+	return sink.export(request)
+}
+
+// Forget drops the cumulative series of a member.
+func (sink *OTLPSink) Forget(member string) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	for key := range sink.series {
+		if strings.HasPrefix(key, member+"\x00") {
+			delete(sink.series, key)
+		}
+	}
+}
+
+// start records the value of a cumulative series and returns the time it
+func (sink *OTLPSink) export(request *colmetricspb.ExportMetricsServiceRequest) error {
+	var (
+		body        []byte
+		contentType string
+		err         error
+	)
+
+	if sink.encoding == OTLPJSON {
+		body, err = protojson.Marshal(request)
+		contentType = "application/json"
+	} else {
+		body, err = proto.Marshal(request)
+		contentType = "application/x-protobuf"
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", sink.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := sink.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("otlp export failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// start records the value of a cumulative series and returns the time it
+// started at: when the sink was created or, once the series went down, when
+// its previous value was sent, as the member restarted since.
+func (sink *OTLPSink) start(key string, value float64, now time.Time) uint64 {
+	series, found := sink.series[key]
+	if !found {
+		series.start = sink.startTime
+	} else if value < series.value {
+		series.start = series.at
+	}
+
+	series.value = value
+	series.at = now
+	sink.series[key] = series
+
+	return uint64(series.start.UnixNano())
+}
+
+// resource returns the resource the metrics of member are batched in.
+func (sink *OTLPSink) resource(member string) *otlpResource {
+	for _, resource := range sink.resources {
+		if resource.member == member {
+			return resource
+		}
+	}
+
+	resource := &otlpResource{
+		member:  member,
+		metrics: map[string]*metricspb.Metric{},
+	}
+	sink.resources = append(sink.resources, resource)
+
+	return resource
+}
+
+// resourceAttributes identifies the job and, when known, the member.
+func (sink *OTLPSink) resourceAttributes(member string) []*commonpb.KeyValue {
+	attributes := []*commonpb.KeyValue{
+		otlpStringAttribute("service.name", sink.jobName),
+		otlpStringAttribute("service.instance.id", sink.index),
+	}
+
+	if member != "" {
+		attributes = append(attributes, otlpStringAttribute("etcd.member.name", member))
+	}
+
+	return attributes
+}
+
+func (sink *OTLPSink) newMetric(name string, metric instrumentation.Metric) *metricspb.Metric {
+	otlpMetric := &metricspb.Metric{
+		Name: name,
+		Unit: otlpUnits[GetMetricUnit(metric)],
+	}
+
+	switch metric.Kind {
+	case instrumentation.Counter:
+		otlpMetric.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}}
+	case instrumentation.Summary:
+		otlpMetric.Data = &metricspb.Metric_Summary{Summary: &metricspb.Summary{}}
+	default:
+		otlpMetric.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}}
+	}
+
+	return otlpMetric
+}
+
+func otlpAttributes(tags map[string]interface{}) []*commonpb.KeyValue {
+	attributes := make([]*commonpb.KeyValue, 0, len(tags))
+	for _, key := range sortedTagKeys(tags) {
+		attributes = append(attributes, otlpStringAttribute(key, fmt.Sprint(tags[key])))
+	}
+
+	return attributes
+}
+
+func otlpStringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
@@ -0,0 +1,343 @@
+package runners_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+	"github.com/onsi/gomega/ghttp"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OTLPSink", func() {
+	var (
+		collector  *ghttp.Server
+		fakeClock  *fakeclock.FakeClock
+		startTime  time.Time
+		encoding   runners.OTLPEncoding
+		memberName string
+		sink       *runners.OTLPSink
+		exported   chan *colmetricspb.ExportMetricsServiceRequest
+	)
+
+	attribute := func(key, value string) *commonpb.KeyValue {
+		return &commonpb.KeyValue{
+			Key:   key,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+		}
+	}
+
+	BeforeEach(func() {
+		collector = ghttp.NewServer()
+		startTime = time.Unix(1475280000, 0)
+		fakeClock = fakeclock.NewFakeClock(startTime)
+		encoding = runners.OTLPProtobuf
+		memberName = "node1"
+		exported = make(chan *colmetricspb.ExportMetricsServiceRequest, 10)
+
+		collector.RouteToHandler("POST", "/v1/metrics", func(w http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(req.Body)
+			Expect(err).NotTo(HaveOccurred())
+
+			request := &colmetricspb.ExportMetricsServiceRequest{}
+			switch req.Header.Get("Content-Type") {
+			case "application/x-protobuf":
+				Expect(proto.Unmarshal(body, request)).To(Succeed())
+			case "application/json":
+				Expect(protojson.Unmarshal(body, request)).To(Succeed())
+			default:
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+
+			exported <- request
+		})
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		sink, err = runners.NewOTLPSink(
+			collector.URL()+"/v1/metrics",
+			encoding,
+			"etcd-diego",
+			"2",
+			func() string { return memberName },
+			http.DefaultClient,
+			fakeClock,
+		)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		collector.Close()
+	})
+
+	itExportsTheMetrics := func() {
+		It("exports gauges, sums and summaries with the member's resource attributes", func() {
+			fakeClock.Increment(time.Minute)
+			now := uint64(fakeClock.Now().UnixNano())
+
+			Expect(sink.Send(instrumentation.Context{
+				Name: "leader",
+				Metrics: []instrumentation.Metric{
+					{Name: "Latency", Value: 0.25, Tags: map[string]interface{}{"follower": "node2"}, Unit: instrumentation.MillisecondsUnit},
+					{Name: "Latency", Value: 0.5, Tags: map[string]interface{}{"follower": "node3"}, Unit: instrumentation.MillisecondsUnit},
+				},
+			})).To(Succeed())
+
+			Expect(sink.Send(instrumentation.Context{
+				Name: "server",
+				Metrics: []instrumentation.Metric{
+					{Name: "SendingBandwidthRate", Value: 3.0, Unit: instrumentation.BytesPerSecondUnit},
+					{Name: "SentAppendRequests", Value: uint64(4321), Kind: instrumentation.Counter},
+				},
+			})).To(Succeed())
+
+			Expect(sink.Send(instrumentation.Context{
+				Name: "metrics",
+				Metrics: []instrumentation.Metric{
+					{
+						Name:  "WalFsyncDuration",
+						Value: instrumentation.SummaryValue{Count: 20102, Sum: 56.83011},
+						Kind:  instrumentation.Summary,
+						Unit:  instrumentation.SecondsUnit,
+					},
+				},
+			})).To(Succeed())
+
+			Expect(sink.Flush()).To(Succeed())
+
+			var request *colmetricspb.ExportMetricsServiceRequest
+			Eventually(exported).Should(Receive(&request))
+
+			Expect(request.ResourceMetrics).To(HaveLen(1))
+			resourceMetrics := request.ResourceMetrics[0]
+
+			Expect(proto.Equal(resourceMetrics.Resource.Attributes[0], attribute("service.name", "etcd-diego"))).To(BeTrue())
+			Expect(proto.Equal(resourceMetrics.Resource.Attributes[1], attribute("service.instance.id", "2"))).To(BeTrue())
+			Expect(proto.Equal(resourceMetrics.Resource.Attributes[2], attribute("etcd.member.name", "node1"))).To(BeTrue())
+
+			Expect(resourceMetrics.ScopeMetrics).To(HaveLen(1))
+			metrics := resourceMetrics.ScopeMetrics[0].Metrics
+			Expect(metrics).To(HaveLen(4))
+
+			Expect(proto.Equal(metrics[0], &metricspb.Metric{
+				Name: "etcd.leader.Latency",
+				Unit: "ms",
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+					DataPoints: []*metricspb.NumberDataPoint{
+						{
+							Attributes:   []*commonpb.KeyValue{attribute("follower", "node2")},
+							TimeUnixNano: now,
+							Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: 0.25},
+						},
+						{
+							Attributes:   []*commonpb.KeyValue{attribute("follower", "node3")},
+							TimeUnixNano: now,
+							Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: 0.5},
+						},
+					},
+				}},
+			})).To(BeTrue())
+
+			Expect(proto.Equal(metrics[1], &metricspb.Metric{
+				Name: "etcd.server.SendingBandwidthRate",
+				Unit: "By/s",
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+					DataPoints: []*metricspb.NumberDataPoint{
+						{
+							TimeUnixNano: now,
+							Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: 3.0},
+						},
+					},
+				}},
+			})).To(BeTrue())
+
+			Expect(proto.Equal(metrics[2], &metricspb.Metric{
+				Name: "etcd.server.SentAppendRequests",
+				Unit: "1",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+					DataPoints: []*metricspb.NumberDataPoint{
+						{
+							StartTimeUnixNano: uint64(startTime.UnixNano()),
+							TimeUnixNano:      now,
+							Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: 4321},
+						},
+					},
+				}},
+			})).To(BeTrue())
+
+			Expect(proto.Equal(metrics[3], &metricspb.Metric{
+				Name: "etcd.metrics.WalFsyncDuration",
+				Unit: "s",
+				Data: &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+					DataPoints: []*metricspb.SummaryDataPoint{
+						{
+							StartTimeUnixNano: uint64(startTime.UnixNano()),
+							TimeUnixNano:      now,
+							Count:             20102,
+							Sum:               56.83011,
+						},
+					},
+				}},
+			})).To(BeTrue())
+		})
+	}
+
+	Context("with the protobuf encoding", func() {
+		itExportsTheMetrics()
+	})
+
+	Context("with the JSON encoding", func() {
+		BeforeEach(func() {
+			encoding = runners.OTLPJSON
+		})
+
+		itExportsTheMetrics()
+	})
+
+	Context("when monitoring a whole cluster", func() {
+		BeforeEach(func() {
+			memberName = ""
+		})
+
+		It("exports the metrics of each member under a resource of its own", func() {
+			for _, member := range []string{"node2", "node3", "node2"} {
+				Expect(sink.Send(instrumentation.Context{
+					Name:    "server",
+					Member:  member,
+					Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1, Tags: map[string]interface{}{"member": member}}},
+				})).To(Succeed())
+			}
+			Expect(sink.Send(instrumentation.Context{
+				Name:    "store",
+				Metrics: []instrumentation.Metric{{Name: "Watchers", Value: 12}},
+			})).To(Succeed())
+			Expect(sink.Flush()).To(Succeed())
+
+			var request *colmetricspb.ExportMetricsServiceRequest
+			Eventually(exported).Should(Receive(&request))
+			Expect(request.ResourceMetrics).To(HaveLen(3))
+
+			node2 := request.ResourceMetrics[0]
+			Expect(node2.Resource.Attributes).To(HaveLen(3))
+			Expect(proto.Equal(node2.Resource.Attributes[2], attribute("etcd.member.name", "node2"))).To(BeTrue())
+			Expect(node2.ScopeMetrics[0].Metrics[0].GetGauge().DataPoints).To(HaveLen(2))
+
+			node3 := request.ResourceMetrics[1]
+			Expect(proto.Equal(node3.Resource.Attributes[2], attribute("etcd.member.name", "node3"))).To(BeTrue())
+
+			Expect(request.ResourceMetrics[2].Resource.Attributes).To(HaveLen(2))
+		})
+	})
+
+	It("attributes the metrics to the name of the member when they are exported", func() {
+		memberName = ""
+		Expect(sink.Send(instrumentation.Context{
+			Name:    "server",
+			Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1}},
+		})).To(Succeed())
+
+		memberName = "node2"
+		Expect(sink.Flush()).To(Succeed())
+
+		var request *colmetricspb.ExportMetricsServiceRequest
+		Eventually(exported).Should(Receive(&request))
+		Expect(proto.Equal(request.ResourceMetrics[0].Resource.Attributes[2], attribute("etcd.member.name", "node2"))).To(BeTrue())
+	})
+
+	Context("when the name of the member is not known", func() {
+		BeforeEach(func() {
+			memberName = ""
+		})
+
+		It("exports without it", func() {
+			Expect(sink.Send(instrumentation.Context{
+				Name:    "server",
+				Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1}},
+			})).To(Succeed())
+			Expect(sink.Flush()).To(Succeed())
+
+			var request *colmetricspb.ExportMetricsServiceRequest
+			Eventually(exported).Should(Receive(&request))
+			Expect(request.ResourceMetrics[0].Resource.Attributes).To(HaveLen(2))
+		})
+	})
+
+	It("starts a sum over once it went down", func() {
+		send := func(value uint64) *metricspb.NumberDataPoint {
+			Expect(sink.Send(instrumentation.Context{
+				Name:    "server",
+				Metrics: []instrumentation.Metric{{Name: "SentAppendRequests", Value: value, Kind: instrumentation.Counter}},
+			})).To(Succeed())
+			Expect(sink.Flush()).To(Succeed())
+
+			var request *colmetricspb.ExportMetricsServiceRequest
+			Eventually(exported).Should(Receive(&request))
+			return request.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetSum().DataPoints[0]
+		}
+
+		fakeClock.Increment(time.Minute)
+		Expect(send(100).StartTimeUnixNano).To(Equal(uint64(startTime.UnixNano())))
+
+		fakeClock.Increment(time.Minute)
+		Expect(send(200).StartTimeUnixNano).To(Equal(uint64(startTime.UnixNano())))
+
+		restartedBy := fakeClock.Now()
+		fakeClock.Increment(time.Minute)
+		Expect(send(10).StartTimeUnixNano).To(Equal(uint64(restartedBy.UnixNano())))
+
+		fakeClock.Increment(time.Minute)
+		Expect(send(20).StartTimeUnixNano).To(Equal(uint64(restartedBy.UnixNano())))
+	})
+
+	It("forgets the sums of a member that went away", func() {
+		send := func(value uint64) *metricspb.NumberDataPoint {
+			Expect(sink.Send(instrumentation.Context{
+				Name:    "server",
+				Member:  "node2",
+				Metrics: []instrumentation.Metric{{Name: "SentAppendRequests", Value: value, Kind: instrumentation.Counter}},
+			})).To(Succeed())
+			Expect(sink.Flush()).To(Succeed())
+
+			var request *colmetricspb.ExportMetricsServiceRequest
+			Eventually(exported).Should(Receive(&request))
+			return request.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetSum().DataPoints[0]
+		}
+
+		fakeClock.Increment(time.Minute)
+		send(100)
+
+		sink.Forget("node2")
+
+		fakeClock.Increment(time.Minute)
+		Expect(send(10).StartTimeUnixNano).To(Equal(uint64(startTime.UnixNano())))
+	})
+
+	It("does not export anything when nothing was sent", func() {
+		Expect(sink.Flush()).To(Succeed())
+		Expect(collector.ReceivedRequests()).To(BeEmpty())
+	})
+
+	It("returns an error when the collector rejects the export", func() {
+		collector.RouteToHandler("POST", "/v1/metrics", ghttp.RespondWith(http.StatusBadRequest, "bad data"))
+
+		Expect(sink.Send(instrumentation.Context{
+			Name:    "server",
+			Metrics: []instrumentation.Metric{{Name: "IsLeader", Value: 1}},
+		})).To(Succeed())
+		Expect(sink.Flush()).To(MatchError("otlp export failed with status 400: bad data"))
+	})
+})
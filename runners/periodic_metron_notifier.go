@@ -1,83 +1,319 @@
 package runners
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"os"
-	"reflect"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
-	"github.com/cloudfoundry/dropsonde/metrics"
+	"google.golang.org/grpc"
 )
 
 type PeriodicMetronNotifier struct {
-	getter   getter
-	etcdURL  string
-	logger   lager.Logger
-	interval time.Duration
+	getter         getter
+	dial           dialFunc
+	discoverer     Discoverer
+	api            EtcdAPI
+	redirectPolicy instruments.RedirectPolicy
+	logger         lager.Logger
+	interval       time.Duration
+	scheduler      *scheduler
+	threshold      int
+	maxBackoff     time.Duration
+	registry       *instrumentation.Registry
+	sinks          []Sink
+
+	lock    sync.RWMutex
+	members []*member
+
+	sinkErrors   uint64
+	droppedTicks uint64
 }
 
 type getter interface {
 	Get(address string) (*http.Response, error)
 }
 
+// dialFunc opens a gRPC connection to the etcd member at etcdURL.
+type dialFunc func(etcdURL string) (*grpc.ClientConn, error)
+
+// NotifierConfig tunes how a PeriodicMetronNotifier collects metrics.
+type NotifierConfig struct {
+	// Dial is used to reach the v3 gRPC API of each member; status collection
+	// is skipped when it is nil.
+	Dial dialFunc
+	// API is the etcd API collected, or EtcdAutoAPI to pick it from each
+	// member's version.
+	API            EtcdAPI
+	RedirectPolicy instruments.RedirectPolicy
+	// Interval is the report interval. Instruments are scraped every interval
+	// unless given an interval of their own in Intervals, which Jitter varies
+	// by up to that fraction. Members are collected from on every interval
+	// or, when an instrument is scraped more often, on every such tick.
+	Interval  time.Duration
+	Intervals ScrapeIntervals
+	Jitter    float64
+	// Threshold is the number of ticks in a row a member could not be reached
+	// on before it is only probed, backing off exponentially up to
+	// MaxBackoff, until it answers again.
+	Threshold  int
+	MaxBackoff time.Duration
+}
+
+// NewPeriodicMetronNotifier collects metrics from every member returned by the
+// discoverer, which is consulted again on every tick, and sends them to the
+// sinks.
 func NewPeriodicMetronNotifier(
 	getter getter,
-	etcdURL string,
+	discoverer Discoverer,
+	registry *instrumentation.Registry,
+	sinks []Sink,
 	logger lager.Logger,
-	interval time.Duration,
+	config NotifierConfig,
 ) *PeriodicMetronNotifier {
 
-	return &PeriodicMetronNotifier{getter, etcdURL, logger, interval}
+	scheduler := newScheduler(config.Interval, config.Intervals, config.Jitter)
+
+	return &PeriodicMetronNotifier{
+		getter:         getter,
+		dial:           config.Dial,
+		discoverer:     discoverer,
+		api:            config.API,
+		redirectPolicy: config.RedirectPolicy,
+		logger:         logger,
+		interval:       scheduler.tick,
+		scheduler:      scheduler,
+		threshold:      config.Threshold,
+		maxBackoff:     config.MaxBackoff,
+		registry:       registry,
+		sinks:          sinks,
+	}
 }
 
-func convertToFloat64(value interface{}) float64 {
-	switch v := value.(type) {
-	case float64:
-		return v
-	case uint64:
-		return float64(v)
-	case int:
-		return float64(v)
-	default:
-		msg := fmt.Sprintf("invalid type %v", reflect.TypeOf(value).Name())
-		panic(msg)
+// HealthContexts returns, for each member name, the contexts the member's
+// health is judged by for the API currently being collected.
+func (n *PeriodicMetronNotifier) HealthContexts() map[string][]string {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	contexts := map[string][]string{}
+	for _, member := range n.members {
+		contexts[member.Name] = member.healthContexts()
 	}
+
+	return contexts
 }
 
-func sendMetrics(instrument instrumentation.Instrumentable) {
-	context := instrument.Emit()
-	for _, metric := range context.Metrics {
-		value := convertToFloat64(metric.Value)
-		unit := GetMetricUnit(metric.Name)
-		metrics.SendValue(metric.Name, value, unit)
+// discover updates the members to collect from. Members are known by their
+// URL, so that one that is renamed, once it reports its name, keeps its state.
+func (n *PeriodicMetronNotifier) discover(ctx context.Context) {
+	etcdMembers, err := n.discoverer.Discover(ctx, n.reachable)
+	if err != nil {
+		n.logger.Error("failed-to-discover-members", err)
+		return
 	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	existing := map[string]*member{}
+	for _, member := range n.members {
+		existing[member.URL] = member
+	}
+
+	members := make([]*member, 0, len(etcdMembers))
+	for _, etcdMember := range etcdMembers {
+		if member, found := existing[etcdMember.URL]; found {
+			if member.Name != etcdMember.Name {
+				n.logger.Info("member-renamed", lager.Data{"name": etcdMember.Name, "previous-name": member.Name, "url": member.URL})
+				n.forget(member.Name)
+				member.rename(etcdMember.Name)
+			}
+
+			members = append(members, member)
+			delete(existing, etcdMember.URL)
+			continue
+		}
+
+		members = append(members, n.newMember(etcdMember))
+	}
+
+	for _, member := range existing {
+		n.logger.Info("member-removed", lager.Data{"name": member.Name, "url": member.URL})
+		member.close()
+		n.forget(member.Name)
+	}
+
+	n.members = members
 }
 
-func (n *PeriodicMetronNotifier) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
-	instruments := []instrumentation.Instrumentable{
-		instruments.NewLeader(n.getter, n.etcdURL, n.logger),
-		instruments.NewServer(n.getter, n.etcdURL, n.logger),
-		instruments.NewStore(n.getter, n.etcdURL, n.logger),
+// reachable reports whether the member at etcdURL may be asked for anything
+// while discovering the members, which it may not while its breaker is open.
+// Members not collected from yet are reachable.
+func (n *PeriodicMetronNotifier) reachable(etcdURL string) bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	for _, member := range n.members {
+		if member.URL == etcdURL {
+			return !member.breaker.open
+		}
+	}
+
+	return true
+}
+
+func (n *PeriodicMetronNotifier) newMember(etcdMember EtcdMember) *member {
+	logger := n.logger
+	if etcdMember.Name != "" {
+		logger = n.logger.Session("member", lager.Data{"name": etcdMember.Name, "url": etcdMember.URL})
+		n.logger.Info("member-added", lager.Data{"name": etcdMember.Name, "url": etcdMember.URL})
+	}
+
+	var conn *grpc.ClientConn
+	if n.dial != nil {
+		var err error
+		conn, err = n.dial(etcdMember.URL)
+		if err != nil {
+			logger.Error("failed-to-dial-etcd", err)
+		}
+	}
+
+	// the leader is collected along with its followers when monitoring a whole
+	// cluster, so following their redirects would only emit its stats again
+	redirectPolicy := n.redirectPolicy
+	if etcdMember.Name != "" && redirectPolicy == instruments.FollowToLeader {
+		redirectPolicy = instruments.SkipOnFollower
+	}
+
+	return newMember(etcdMember, n.getter, conn, n.api, redirectPolicy, n.interval, n.scheduler, newBreaker(n.threshold, n.interval, n.maxBackoff), logger)
+}
+
+func (n *PeriodicMetronNotifier) sendMetrics(context instrumentation.Context) {
+	n.registry.Record(context)
+
+	for _, sink := range n.sinks {
+		err := sink.Send(context)
+		if err != nil {
+			n.sinkErrors++
+			n.logger.Error("failed-to-send-metrics", err, lager.Data{
+				"context": context.Name,
+			})
+		}
+	}
+}
+
+// forget drops what was recorded for a member that was removed or renamed.
+func (n *PeriodicMetronNotifier) forget(name string) {
+	n.registry.Forget(name)
+
+	for _, sink := range n.sinks {
+		if forgetter, ok := sink.(Forgetter); ok {
+			forgetter.Forget(name)
+		}
+	}
+}
+
+func (n *PeriodicMetronNotifier) flushSinks() {
+	for _, sink := range n.sinks {
+		if flusher, ok := sink.(Flusher); ok {
+			err := flusher.Flush()
+			if err != nil {
+				n.sinkErrors++
+				n.logger.Error("failed-to-flush-metrics", err)
+			}
+		}
+	}
+}
+
+// collect scrapes every member concurrently, so that an unresponsive member
+// does not delay the others, and sends each context as soon as it is
+// collected. The metrics server's own metrics follow once every member is
+// done. Discovering the members, detecting their versions and scraping them
+// all have to be done by the next tick.
+func (n *PeriodicMetronNotifier) collect(ctx context.Context, tick time.Time) {
+	tickCtx, cancel := context.WithDeadline(ctx, tick.Add(n.interval))
+	defer cancel()
+
+	n.discover(tickCtx)
+
+	n.lock.RLock()
+	members := n.members
+	n.lock.RUnlock()
+
+	collected := make(chan instrumentation.Context)
+
+	wg := sync.WaitGroup{}
+	for _, m := range members {
+		wg.Add(1)
+		go func(m *member) {
+			defer wg.Done()
+			m.collect(tickCtx, func(context instrumentation.Context) {
+				collected <- context
+			})
+		}(m)
 	}
 
+	go func() {
+		wg.Wait()
+		close(collected)
+	}()
+
+	emitted := 0
+	for context := range collected {
+		// what is collected once shutting down has begun is not sent
+		if ctx.Err() != nil {
+			continue
+		}
+
+		emitted += len(context.Metrics)
+		n.sendMetrics(context)
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	n.sendMetrics(n.selfContext(members, emitted))
+	n.flushSinks()
+}
+
+func (n *PeriodicMetronNotifier) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 	ticker := time.NewTicker(n.interval)
 	defer ticker.Stop()
 
+	// a signal cancels the scrapes in flight so that shutting down does not
+	// wait for an unresponsive member
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	close(ready)
 
+	var previousTick time.Time
 	for {
 		select {
-		case <-ticker.C:
+		case tick := <-ticker.C:
+			n.countDroppedTicks(previousTick, tick)
+			previousTick = tick
 
-			for _, instrument := range instruments {
-				sendMetrics(instrument)
-			}
+			n.collect(ctx, tick)
 
-		case <-signals:
+		case <-ctx.Done():
+			for _, member := range n.members {
+				member.close()
+			}
 			return nil
 		}
 	}
@@ -1,18 +1,27 @@
 package runners_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager/lagertest"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/fakes"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instruments"
 	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
 	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
 	"github.com/cloudfoundry/dropsonde/metrics"
 	"github.com/onsi/gomega/ghttp"
 	"github.com/tedsuo/ifrit"
+	"google.golang.org/grpc"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -29,15 +38,31 @@ var _ = Describe("PeriodicMetronNotifier", func() {
 		logger = lagertest.NewTestLogger("test")
 		sender *fake.FakeMetricSender
 
-		etcdURL        string
+		etcdURL    string
+		discoverer interface {
+			Discover(context.Context, func(string) bool) ([]runners.EtcdMember, error)
+		}
+		dial           func(string) (*grpc.ClientConn, error)
+		etcdAPI        runners.EtcdAPI
+		redirectPolicy instruments.RedirectPolicy
 		reportInterval time.Duration
+		intervals      runners.ScrapeIntervals
+		threshold      int
+		maxBackoff     time.Duration
 
+		notifier       *runners.PeriodicMetronNotifier
 		metronNotifier ifrit.Process
 		fakeGetter     *fakes.Getter
+		registry       *instrumentation.Registry
+		sinks          []runners.Sink
 	)
 
 	BeforeEach(func() {
 		fakeGetter = &fakes.Getter{}
+		dial = nil
+		etcdAPI = runners.EtcdV2API
+		redirectPolicy = instruments.SkipOnFollower
+		discoverer = nil
 		leader = ghttp.NewServer()
 		follower = ghttp.NewServer()
 
@@ -47,6 +72,7 @@ var _ = Describe("PeriodicMetronNotifier", func() {
 			w.Header().Set("X-Raft-Term", "1")
 		}
 
+		leader.RouteToHandler("GET", "/version", ghttp.RespondWith(200, fixtureV2Version))
 		leader.RouteToHandler("GET", "/v2/stats/leader", ghttp.RespondWith(200, fixtureLeaderStats))
 		leader.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(200, fixtureSelfLeaderStats))
 		leader.RouteToHandler("GET", "/v2/stats/store", ghttp.RespondWith(200, fixtureStoreStats))
@@ -56,22 +82,52 @@ var _ = Describe("PeriodicMetronNotifier", func() {
 			http.Redirect(w, r, leader.URL(), 302)
 		})
 
+		follower.RouteToHandler("GET", "/version", ghttp.RespondWith(200, fixtureV2Version))
 		follower.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(200, fixtureSelfFollowerStats))
 		follower.RouteToHandler("GET", "/v2/stats/store", ghttp.RespondWith(200, fixtureStoreStats))
 		follower.RouteToHandler("GET", "/v2/keys/", keyHandler)
 
 		reportInterval = 100 * time.Millisecond
+		intervals = runners.ScrapeIntervals{}
+		threshold = 3
+		maxBackoff = time.Second
 		sender = fake.NewFakeMetricSender()
 		metrics.Initialize(sender, nil)
+
+		registry = instrumentation.NewRegistry(clock.NewClock())
+		sinks = []runners.Sink{runners.NewDropsondeSink()}
 	})
 
+	recordedContexts := func() []string {
+		names := []string{}
+		for _, context := range registry.Contexts() {
+			names = append(names, context.Name)
+		}
+		return names
+	}
+
 	JustBeforeEach(func() {
-		metronNotifier = ifrit.Invoke(runners.NewPeriodicMetronNotifier(
+		if discoverer == nil {
+			discoverer = runners.NewSingleMemberDiscoverer(fakeGetter, etcdURL)
+		}
+
+		notifier = runners.NewPeriodicMetronNotifier(
 			fakeGetter,
-			etcdURL,
+			discoverer,
+			registry,
+			sinks,
 			logger,
-			reportInterval,
-		))
+			runners.NotifierConfig{
+				Dial:           dial,
+				API:            etcdAPI,
+				RedirectPolicy: redirectPolicy,
+				Interval:       reportInterval,
+				Intervals:      intervals,
+				Threshold:      threshold,
+				MaxBackoff:     maxBackoff,
+			},
+		)
+		metronNotifier = ifrit.Invoke(notifier)
 	})
 
 	AfterEach(func() {
@@ -92,6 +148,12 @@ var _ = Describe("PeriodicMetronNotifier", func() {
 			}), fmt.Sprintf("failed to get metric %s", name))
 		}
 
+		var counterEmitted = func(name string, total uint64) {
+			Eventually(func() uint64 {
+				return sender.GetCounter(name)
+			}).Should(Equal(total), fmt.Sprintf("failed to get counter %s", name))
+		}
+
 		var metricNotEmitted = func(name string) {
 			Consistently(func() fake.Metric {
 				return sender.GetValue(name)
@@ -99,21 +161,21 @@ var _ = Describe("PeriodicMetronNotifier", func() {
 		}
 
 		var itShouldEmitStoreResults = func() {
-			metricEmitted("CompareAndDeleteFail", 0, runners.MetricUnit)
-			metricEmitted("CompareAndDeleteSuccess", 4, runners.MetricUnit)
-			metricEmitted("CompareAndSwapFail", 22, runners.MetricUnit)
-			metricEmitted("CompareAndSwapSuccess", 50350, runners.MetricUnit)
-			metricEmitted("CreateFail", 15252, runners.MetricUnit)
-			metricEmitted("CreateSuccess", 18, runners.MetricUnit)
-			metricEmitted("DeleteFail", 0, runners.MetricUnit)
-			metricEmitted("DeleteSuccess", 0, runners.MetricUnit)
-			metricEmitted("ExpireCount", 1, runners.MetricUnit)
-			metricEmitted("GetsFail", 26705, runners.MetricUnit)
-			metricEmitted("GetsSuccess", 10195, runners.MetricUnit)
-			metricEmitted("SetsFail", 0, runners.MetricUnit)
-			metricEmitted("SetsSuccess", 2540, runners.MetricUnit)
-			metricEmitted("UpdateFail", 0, runners.MetricUnit)
-			metricEmitted("UpdateSuccess", 0, runners.MetricUnit)
+			counterEmitted("CompareAndDeleteFail", 0)
+			counterEmitted("CompareAndDeleteSuccess", 4)
+			counterEmitted("CompareAndSwapFail", 22)
+			counterEmitted("CompareAndSwapSuccess", 50350)
+			counterEmitted("CreateFail", 15252)
+			counterEmitted("CreateSuccess", 18)
+			counterEmitted("DeleteFail", 0)
+			counterEmitted("DeleteSuccess", 0)
+			counterEmitted("ExpireCount", 1)
+			counterEmitted("GetsFail", 26705)
+			counterEmitted("GetsSuccess", 10195)
+			counterEmitted("SetsFail", 0)
+			counterEmitted("SetsSuccess", 2540)
+			counterEmitted("UpdateFail", 0)
+			counterEmitted("UpdateSuccess", 0)
 			metricEmitted("Watchers", 12, runners.MetricUnit)
 			metricEmitted("EtcdIndex", 3, runners.MetricUnit)
 			metricEmitted("RaftIndex", 2, runners.MetricUnit)
@@ -131,15 +193,16 @@ var _ = Describe("PeriodicMetronNotifier", func() {
 
 			It("should emit self (follower) statistics", func() {
 				metricEmitted("IsLeader", 0, runners.MetricUnit)
-				metricEmitted("SentAppendRequests", 4321, runners.MetricUnit)
-				metricEmitted("ReceivedAppendRequests", 1234, runners.MetricUnit)
-				metricEmitted("ReceivingRequestRate", 2.0, runners.RequestsPerSecondUnit)
-				metricEmitted("ReceivingBandwidthRate", 1.2, runners.BytesPerSecondUnit)
+				counterEmitted("SentAppendRequests", 4321)
+				counterEmitted("ReceivedAppendRequests", 1234)
+				metricEmitted("ReceivingRequestRate", 2.0, instrumentation.RequestsPerSecondUnit)
+				metricEmitted("ReceivingBandwidthRate", 1.2, instrumentation.BytesPerSecondUnit)
 			})
 
 			It("should not emit leader statistics", func() {
 				metricNotEmitted("Followers")
-				metricNotEmitted("Latency")
+				metricNotEmitted("Latency.node1-id")
+				metricNotEmitted("Latency.node3-id")
 			})
 		})
 
@@ -154,25 +217,727 @@ var _ = Describe("PeriodicMetronNotifier", func() {
 
 			It("should emit self (leader) statistics", func() {
 				metricEmitted("IsLeader", 1, runners.MetricUnit)
-				metricEmitted("SentAppendRequests", 4321, runners.MetricUnit)
-				metricEmitted("ReceivedAppendRequests", 1234, runners.MetricUnit)
-				metricEmitted("SendingRequestRate", 5.0, runners.RequestsPerSecondUnit)
-				metricEmitted("SendingBandwidthRate", 3.0, runners.BytesPerSecondUnit)
+				counterEmitted("SentAppendRequests", 4321)
+				counterEmitted("ReceivedAppendRequests", 1234)
+				metricEmitted("SendingRequestRate", 5.0, instrumentation.RequestsPerSecondUnit)
+				metricEmitted("SendingBandwidthRate", 3.0, instrumentation.BytesPerSecondUnit)
 			})
 
 			It("should emit leader statistics", func() {
-				metricEmitted("Followers", 1, runners.MetricUnit)
-				metricEmitted("Latency", 0.153507, runners.MetricUnit)
+				metricEmitted("Followers", 2, runners.MetricUnit)
+			})
+
+			It("should emit the latency of each follower under its own name", func() {
+				metricEmitted("Latency.node1-id", 0.153507, instrumentation.MillisecondsUnit)
+				metricEmitted("Latency.node3-id", 0.312345, instrumentation.MillisecondsUnit)
+				metricEmitted("LatencyMaximum.node1-id", 6.78157, instrumentation.MillisecondsUnit)
+				counterEmitted("FailCount.node1-id", 4)
+				counterEmitted("SuccessCount.node3-id", 215004)
+			})
+		})
+
+		Context("when sinks are configured", func() {
+			var sink *fakes.Sink
+
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+				sink = &fakes.Sink{}
+				sinks = append(sinks, sink)
+			})
+
+			It("sends every context to each sink and flushes them", func() {
+				Eventually(sink.FlushCallCount).Should(BeNumerically(">=", 1))
+
+				contexts := sink.SentContexts()
+				Expect(len(contexts)).To(BeNumerically(">=", 4))
+				names := []string{}
+				for _, context := range contexts[:4] {
+					names = append(names, context.Name)
+				}
+				Expect(names).To(ConsistOf("version", "leader", "server", "store"))
+			})
+
+			Context("when an instrument is still being scraped", func() {
+				BeforeEach(func() {
+					leader.RouteToHandler("GET", "/v2/keys/", func(w http.ResponseWriter, r *http.Request) {
+						time.Sleep(3 * reportInterval)
+					})
+				})
+
+				It("sends what the others collected without waiting for it", func() {
+					sentNames := func() []string {
+						names := []string{}
+						for _, context := range sink.SentContexts() {
+							names = append(names, context.Name)
+						}
+						return names
+					}
+
+					Eventually(sentNames, 2*reportInterval).Should(ContainElement("server"))
+					Expect(sentNames()).NotTo(ContainElement("store"))
+					Expect(sink.FlushCallCount()).To(BeZero())
+				})
+			})
+		})
+
+		Context("when the follower counts grow between intervals", func() {
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+
+				requests := 0
+				leader.RouteToHandler("GET", "/v2/stats/leader", func(w http.ResponseWriter, r *http.Request) {
+					requests++
+					w.Write([]byte(fmt.Sprintf(`{"leader": "node2-id", "followers": {"node1-id": {"counts": {"fail": %d, "success": %d}}}}`, requests, 3*requests)))
+				})
+			})
+
+			It("emits the failure ratio over each interval", func() {
+				metricEmitted("FailureRatio.node1-id", 0.25, runners.MetricUnit)
+			})
+		})
+
+		Context("when reporting on itself", func() {
+			var sink *fakes.Sink
+
+			selfMetric := func(name string, tags map[string]interface{}) interface{} {
+				context, _, _ := registry.Latest("", "metrics_server")
+				for _, metric := range context.Metrics {
+					if metric.Name == name && (tags == nil || reflect.DeepEqual(metric.Tags, tags)) {
+						return metric.Value
+					}
+				}
+				return nil
+			}
+
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+				sink = &fakes.Sink{}
+				sinks = append(sinks, sink)
+			})
+
+			It("sends its own metrics after those of etcd", func() {
+				Eventually(sink.FlushCallCount).Should(BeNumerically(">=", 1))
+				Expect(sink.SentContexts()[4].Name).To(Equal("endpoint"))
+				Expect(sink.SentContexts()[5].Name).To(Equal("metrics_server"))
+
+				Expect(selfMetric("ScrapesSucceeded", map[string]interface{}{"instrument": "server"})).To(BeNumerically(">=", 1))
+				Expect(selfMetric("ScrapesFailed", map[string]interface{}{"instrument": "server"})).To(BeEquivalentTo(0))
+				Expect(selfMetric("ScrapeDuration", map[string]interface{}{"instrument": "store"})).To(BeNumerically(">", 0))
+				Expect(selfMetric("MetricsEmitted", nil)).To(BeNumerically(">", 20))
+				Expect(selfMetric("Goroutines", nil)).To(BeNumerically(">", 0))
+				Expect(selfMetric("HeapAlloc", nil)).To(BeNumerically(">", 0))
+				Expect(selfMetric("GCPause", nil)).To(BeAssignableToTypeOf(instrumentation.SummaryValue{}))
+			})
+
+			Context("when an instrument fails", func() {
+				BeforeEach(func() {
+					leader.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(http.StatusInternalServerError, "{"))
+				})
 
-				// We wanted to test multiple followers and ensure that
-				// multiple latencies were reported. But due to limitations of
-				// the dropsonde protocol not accepting tags, the fake metrics
-				// server cannot distinguish multiple latency metrics.
+				It("counts the failed scrapes", func() {
+					Eventually(func() interface{} {
+						return selfMetric("ScrapesFailed", map[string]interface{}{"instrument": "server"})
+					}).Should(BeNumerically(">=", 2))
+					Expect(selfMetric("ScrapesSucceeded", map[string]interface{}{"instrument": "server"})).To(BeEquivalentTo(0))
+				})
+			})
+
+			Context("when a sink fails", func() {
+				BeforeEach(func() {
+					sink.SendCall.Returns.Error = errors.New("connection refused")
+				})
+
+				It("counts its errors", func() {
+					Eventually(func() interface{} {
+						return selfMetric("SinkErrors", nil)
+					}).Should(BeNumerically(">=", 5))
+				})
+			})
+		})
+
+		Context("when an instrument is slower than the report interval", func() {
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+				leader.RouteToHandler("GET", "/v2/keys/", func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(3 * reportInterval)
+				})
+			})
+
+			It("keeps collecting the other instruments on every interval", func() {
+				var firstCollected time.Time
+				Eventually(func() bool {
+					var found bool
+					_, firstCollected, found = registry.Latest("", "server")
+					return found
+				}, 3*reportInterval).Should(BeTrue())
+
+				Eventually(func() time.Time {
+					_, collectedAt, _ := registry.Latest("", "server")
+					return collectedAt
+				}, 3*reportInterval).Should(BeTemporally(">", firstCollected))
+
+				store, _, found := registry.Latest("", "store")
+				Expect(found).To(BeTrue())
+				Expect(store.Metrics).To(BeEmpty())
+
+				scrapeFailures := func() []string {
+					instruments := []string{}
+					for _, log := range logger.Logs() {
+						if log.Message == "test.failed-to-scrape-instrument" {
+							instruments = append(instruments, log.Data["instrument"].(string))
+						}
+					}
+					return instruments
+				}
+				Expect(scrapeFailures()).To(ContainElement("store"))
+				Expect(scrapeFailures()).NotTo(ContainElement("server"))
+			})
+		})
+
+		Context("when detecting the version takes most of the report interval", func() {
+			var sink *fakes.Sink
+
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+				sink = &fakes.Sink{}
+				sinks = append(sinks, sink)
+
+				leader.RouteToHandler("GET", "/version", func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(8 * reportInterval / 10)
+					w.Write([]byte(fixtureV2Version))
+				})
+				leader.RouteToHandler("GET", "/v2/keys/", func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(reportInterval / 2)
+					w.Header().Set("X-Etcd-Index", "3")
+				})
+			})
+
+			It("leaves the scrapes only what is left of it", func() {
+				Eventually(sink.FlushCallCount, 3*reportInterval).Should(BeNumerically(">=", 1))
+
+				stores := []instrumentation.Context{}
+				for _, context := range sink.SentContexts() {
+					if context.Name == "store" {
+						stores = append(stores, context)
+					}
+				}
+				Expect(stores).NotTo(BeEmpty())
+				Expect(stores[0].Metrics).To(BeEmpty())
+			})
+		})
+
+		Context("when an instrument has an interval of its own", func() {
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+				intervals = runners.ScrapeIntervals{"store": 4 * reportInterval}
+			})
+
+			requests := func(path string) int {
+				count := 0
+				for _, request := range leader.ReceivedRequests() {
+					if request.URL.Path == path {
+						count++
+					}
+				}
+				return count
+			}
+
+			It("scrapes it less often than the others", func() {
+				Eventually(func() int { return requests("/v2/stats/self") }, 10*reportInterval).Should(BeNumerically(">=", 8))
+				Expect(requests("/v2/stats/store")).To(BeNumerically("<=", 3))
+				Expect(requests("/v2/stats/store")).To(BeNumerically(">=", 1))
+			})
+
+			Context("that is shorter than the report interval", func() {
+				BeforeEach(func() {
+					intervals = runners.ScrapeIntervals{"server": reportInterval / 4}
+				})
+
+				It("scrapes it more often than the others", func() {
+					Eventually(func() int { return requests("/v2/stats/self") }, 10*reportInterval).Should(BeNumerically(">=", 16))
+					Expect(requests("/v2/stats/store")).To(BeNumerically("<=", 6))
+					Expect(requests("/v2/stats/store")).To(BeNumerically(">=", 1))
+				})
+			})
+		})
+
+		Context("when the member stops answering", func() {
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+				threshold = 2
+				maxBackoff = 4 * reportInterval
+			})
+
+			reachable := func() interface{} {
+				context, _, found := registry.Latest("", "endpoint")
+				if !found {
+					return nil
+				}
+				return context.Metrics[0].Value
+			}
+
+			requests := func(path string) int {
+				count := 0
+				for _, request := range leader.ReceivedRequests() {
+					if request.URL.Path == path {
+						count++
+					}
+				}
+				return count
+			}
+
+			logged := func(message string) int {
+				count := 0
+				for _, log := range logger.Logs() {
+					if log.Message == "test."+message {
+						count++
+					}
+				}
+				return count
+			}
+
+			It("backs off until it answers again", func() {
+				Eventually(reachable).Should(Equal(1))
+				tripped := logged("etcd-unreachable")
+				recovered := logged("etcd-reachable-again")
+
+				for _, path := range []string{"/version", "/v2/stats/leader", "/v2/stats/self", "/v2/stats/store", "/v2/keys/"} {
+					leader.RouteToHandler("GET", path, ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+				}
+
+				Eventually(reachable, 5*reportInterval).Should(Equal(0))
+				Expect(logged("etcd-unreachable")).To(Equal(tripped + 1))
+
+				By("only probing the member")
+				scrapes := requests("/v2/stats/self")
+				Consistently(func() int { return requests("/v2/stats/self") }, 6*reportInterval).Should(Equal(scrapes))
+				Expect(requests("/version")).To(BeNumerically(">=", 2))
+				Expect(logged("etcd-unreachable")).To(Equal(tripped + 1))
+
+				By("recovering once it answers")
+				leader.RouteToHandler("GET", "/version", ghttp.RespondWith(200, fixtureV2Version))
+				leader.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(200, fixtureSelfLeaderStats))
+
+				Eventually(reachable, 2*maxBackoff).Should(Equal(1))
+				Expect(logged("etcd-reachable-again")).To(Equal(recovered + 1))
+				Eventually(func() int { return requests("/v2/stats/self") }).Should(BeNumerically(">", scrapes))
+			})
+		})
+
+		Context("when signalled while an instrument is being scraped", func() {
+			var (
+				scraping chan struct{}
+				unblock  chan struct{}
+			)
+
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+				reportInterval = time.Second
+
+				scraping = make(chan struct{}, 1)
+				unblock = make(chan struct{})
+				leader.RouteToHandler("GET", "/v2/keys/", func(w http.ResponseWriter, r *http.Request) {
+					select {
+					case scraping <- struct{}{}:
+					default:
+					}
+					<-unblock
+				})
+			})
+
+			AfterEach(func() {
+				close(unblock)
+			})
+
+			It("exits without waiting for the scrape to finish", func() {
+				Eventually(scraping, 2*reportInterval).Should(Receive())
+
+				metronNotifier.Signal(os.Interrupt)
+				Eventually(metronNotifier.Wait(), reportInterval/2).Should(Receive())
+			})
+		})
+
+		Context("when the leader changes between intervals", func() {
+			BeforeEach(func() {
+				etcdURL = follower.URL()
+
+				requests := 0
+				follower.RouteToHandler("GET", "/v2/stats/self", func(w http.ResponseWriter, r *http.Request) {
+					requests++
+					w.Write([]byte(fmt.Sprintf(`{"name": "node1", "leaderInfo": {"leader": "node%d-id", "uptime": "1s"}}`, requests%2+2)))
+				})
+			})
+
+			It("keeps counting the changes across intervals", func() {
+				Eventually(func() uint64 {
+					return sender.GetCounter("LeaderChanges")
+				}, 4*reportInterval).Should(BeNumerically(">=", 2))
+			})
+		})
+
+		Context("when contexts are emitted", func() {
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+			})
+
+			It("records them in the registry", func() {
+				Eventually(recordedContexts).Should(ConsistOf([]string{"version", "leader", "server", "store", "endpoint", "metrics_server"}))
+			})
+		})
+
+		Context("when the etcd version is detected", func() {
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+			})
+
+			It("emits the server and cluster versions", func() {
+				Eventually(func() []instrumentation.Metric {
+					context, _, _ := registry.Latest("", "version")
+					return context.Metrics
+				}).Should(Equal([]instrumentation.Metric{
+					{
+						Name:  "Version",
+						Value: 1,
+						Tags: map[string]interface{}{
+							"etcdserver":  "2.3.7",
+							"etcdcluster": "2.3.0",
+						},
+					},
+				}))
+			})
+
+			It("only detects it once while the member is reachable", func() {
+				Eventually(registry.Contexts, 3*reportInterval).Should(HaveLen(6))
+				time.Sleep(2 * reportInterval)
+
+				versionRequests := 0
+				for _, request := range leader.ReceivedRequests() {
+					if request.URL.Path == "/version" {
+						versionRequests++
+					}
+				}
+				Expect(versionRequests).To(Equal(1))
+			})
+		})
+
+		Context("when monitoring the v3 API", func() {
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+				etcdAPI = runners.EtcdV3API
+				leader.RouteToHandler("GET", "/version", ghttp.RespondWith(200, fixtureV34Version))
+				leader.RouteToHandler("GET", "/metrics", ghttp.RespondWith(200, fixtureV3Metrics))
+			})
+
+			It("scrapes the metrics endpoint instead of the v2 stats", func() {
+				Eventually(func() float64 {
+					return sender.GetValue("HasLeader").Value
+				}, reportInterval+aBit).Should(Equal(1.0))
+
+				Expect(recordedContexts()).To(ConsistOf([]string{"version", "metrics", "endpoint", "metrics_server"}))
+			})
+
+			Context("when the member cannot be dialled", func() {
+				BeforeEach(func() {
+					dial = func(string) (*grpc.ClientConn, error) {
+						return nil, errors.New("bad address")
+					}
+				})
+
+				It("judges its health without the status", func() {
+					Eventually(recordedContexts).Should(ContainElement("metrics"))
+					Expect(notifier.HealthContexts()).To(Equal(map[string][]string{"": {"metrics"}}))
+				})
+			})
+		})
+
+		Context("when monitoring a whole cluster", func() {
+			BeforeEach(func() {
+				discoverer = runners.NewStaticDiscoverer(fakeGetter, []string{leader.URL(), follower.URL()})
+			})
+
+			It("collects the metrics of every member tagged with its name", func() {
+				Eventually(func() fake.Metric {
+					return sender.GetValue("IsLeader.node1")
+				}).Should(Equal(fake.Metric{Value: 0, Unit: runners.MetricUnit}))
+
+				Eventually(func() fake.Metric {
+					return sender.GetValue("IsLeader.node2")
+				}).Should(Equal(fake.Metric{Value: 1, Unit: runners.MetricUnit}))
+
+				context, _, found := registry.Latest("node1", "server")
+				Expect(found).To(BeTrue())
+				Expect(context.Member).To(Equal("node1"))
+				for _, metric := range context.Metrics {
+					Expect(metric.Tags).To(HaveKeyWithValue("member", "node1"))
+				}
+
+				Expect(notifier.HealthContexts()).To(Equal(map[string][]string{
+					"node1": {"server", "store"},
+					"node2": {"server", "store"},
+				}))
+			})
+
+			Context("when following the redirects of followers", func() {
+				BeforeEach(func() {
+					redirectPolicy = instruments.FollowToLeader
+				})
+
+				It("only emits the leader stats for the leader", func() {
+					Eventually(func() []instrumentation.Metric {
+						context, _, _ := registry.Latest("node2", "leader")
+						return context.Metrics
+					}).ShouldNot(BeEmpty())
+
+					Eventually(func() bool {
+						_, _, found := registry.Latest("node1", "leader")
+						return found
+					}).Should(BeTrue())
+
+					context, _, _ := registry.Latest("node1", "leader")
+					Expect(context.Metrics).To(BeEmpty())
+				})
+			})
+
+			Context("when a member only reports its name once it is up", func() {
+				var followerUp int32
+
+				BeforeEach(func() {
+					atomic.StoreInt32(&followerUp, 0)
+					follower.RouteToHandler("GET", "/v2/stats/self", func(w http.ResponseWriter, r *http.Request) {
+						if atomic.LoadInt32(&followerUp) == 0 {
+							w.WriteHeader(http.StatusServiceUnavailable)
+							return
+						}
+						w.Write([]byte(fixtureSelfFollowerStats))
+					})
+				})
+
+				It("renames the member instead of replacing it", func() {
+					address := strings.TrimPrefix(follower.URL(), "http://")
+
+					Eventually(func() bool {
+						_, _, found := registry.Latest(address, "store")
+						return found
+					}).Should(BeTrue())
+
+					atomic.StoreInt32(&followerUp, 1)
+
+					Eventually(func() bool {
+						_, _, found := registry.Latest("node1", "server")
+						return found
+					}).Should(BeTrue())
+
+					_, _, found := registry.Latest(address, "store")
+					Expect(found).To(BeFalse())
+
+					messages := []string{}
+					for _, log := range logger.Logs() {
+						if log.Data["url"] == follower.URL() {
+							messages = append(messages, log.Message)
+						}
+					}
+					Expect(messages).To(ContainElement("test.member-renamed"))
+					Expect(messages).NotTo(ContainElement("test.member-removed"))
+				})
+			})
+
+			Context("when a member cannot be reached before it has reported its name", func() {
+				BeforeEach(func() {
+					threshold = 1
+					for _, path := range []string{"/version", "/v2/stats/leader", "/v2/stats/self", "/v2/stats/store", "/v2/keys/"} {
+						follower.RouteToHandler("GET", path, ghttp.RespondWith(http.StatusServiceUnavailable, ""))
+					}
+				})
+
+				It("does not look its name up while backing off from it", func() {
+					followerName := strings.TrimPrefix(follower.URL(), "http://")
+					Eventually(func() interface{} {
+						context, _, found := registry.Latest(followerName, "endpoint")
+						if !found {
+							return nil
+						}
+						return context.Metrics[0].Value
+					}).Should(Equal(0))
+
+					lookups := func() int {
+						count := 0
+						for _, request := range follower.ReceivedRequests() {
+							if request.URL.Path == "/v2/stats/self" {
+								count++
+							}
+						}
+						return count
+					}
+
+					looked := lookups()
+					Consistently(lookups, 5*reportInterval).Should(Equal(looked))
+				})
+			})
+
+			Context("when members are discovered through the v2 members API", func() {
+				var (
+					members  string
+					fakeSink *fakes.Sink
+				)
+
+				BeforeEach(func() {
+					fakeSink = &fakes.Sink{}
+					sinks = append(sinks, fakeSink)
+
+					members = fmt.Sprintf(`{"members":[
+						{"id":"node1-id","name":"node1","clientURLs":[%q]},
+						{"id":"node2-id","name":"node2","clientURLs":[%q]}
+					]}`, follower.URL(), leader.URL())
+
+					leader.RouteToHandler("GET", "/v2/members", func(w http.ResponseWriter, r *http.Request) {
+						w.Write([]byte(members))
+					})
+
+					discoverer = runners.NewV2MembersDiscoverer(fakeGetter, []string{leader.URL()}, 0, clock.NewClock())
+				})
+
+				It("collects the metrics of every member", func() {
+					Eventually(func() bool {
+						_, _, found := registry.Latest("node1", "store")
+						return found
+					}).Should(BeTrue())
+
+					Eventually(func() bool {
+						_, _, found := registry.Latest("node2", "store")
+						return found
+					}).Should(BeTrue())
+				})
+
+				It("stops collecting from members that leave the cluster", func() {
+					Eventually(func() bool {
+						_, _, found := registry.Latest("node1", "store")
+						return found
+					}).Should(BeTrue())
+
+					members = fmt.Sprintf(`{"members":[{"id":"node2-id","name":"node2","clientURLs":[%q]}]}`, leader.URL())
+
+					Eventually(func() bool {
+						_, _, found := registry.Latest("node1", "store")
+						return found
+					}).Should(BeFalse())
+					Expect(notifier.HealthContexts()).To(HaveLen(1))
+					Expect(fakeSink.ForgottenMembers()).To(Equal([]string{"node1"}))
+				})
+			})
+		})
+
+		Context("when the API is detected automatically", func() {
+			BeforeEach(func() {
+				etcdURL = leader.URL()
+				etcdAPI = runners.EtcdAutoAPI
+				leader.RouteToHandler("GET", "/metrics", ghttp.RespondWith(200, fixtureV3Metrics))
+			})
+
+			Context("and the member runs etcd 2", func() {
+				It("collects the v2 stats", func() {
+					Eventually(recordedContexts).Should(ConsistOf([]string{"version", "leader", "server", "store", "endpoint", "metrics_server"}))
+					Expect(notifier.HealthContexts()).To(Equal(map[string][]string{"": {"server", "store"}}))
+				})
+			})
+
+			Context("and the member runs etcd 3.4", func() {
+				BeforeEach(func() {
+					leader.RouteToHandler("GET", "/version", ghttp.RespondWith(200, fixtureV34Version))
+				})
+
+				It("scrapes the metrics endpoint", func() {
+					Eventually(recordedContexts).Should(ConsistOf([]string{"version", "metrics", "endpoint", "metrics_server"}))
+					Expect(notifier.HealthContexts()).To(Equal(map[string][]string{"": {"metrics"}}))
+				})
+			})
+
+			Context("and the cluster is being migrated to etcd 3", func() {
+				BeforeEach(func() {
+					leader.RouteToHandler("GET", "/version", ghttp.RespondWith(200, `{"etcdserver":"3.3.25","etcdcluster":"2.3.0"}`))
+				})
+
+				It("collects both the v2 stats and the metrics endpoint", func() {
+					Eventually(recordedContexts).Should(ConsistOf([]string{"version", "leader", "server", "store", "metrics", "endpoint", "metrics_server"}))
+					Expect(notifier.HealthContexts()).To(Equal(map[string][]string{"": {"metrics", "server", "store"}}))
+				})
+
+				It("sends the leadership metrics from the metrics endpoint only", func() {
+					Eventually(recordedContexts).Should(ContainElement("server"))
+
+					names := func(name string) []string {
+						context, _, _ := registry.Latest("", name)
+						names := []string{}
+						for _, metric := range context.Metrics {
+							names = append(names, metric.Name)
+						}
+						return names
+					}
+
+					Expect(names("server")).To(ContainElement("SentAppendRequests"))
+					Expect(names("server")).NotTo(ContainElement("IsLeader"))
+					Expect(names("server")).NotTo(ContainElement("HasLeader"))
+					Expect(names("server")).NotTo(ContainElement("LeaderChanges"))
+
+					Eventually(func() []string { return names("metrics") }).Should(ContainElement("IsLeader"))
+				})
+			})
+
+			Context("and the member reports a version that cannot be read", func() {
+				BeforeEach(func() {
+					leader.RouteToHandler("GET", "/version", ghttp.RespondWith(200, `{"etcdserver":"not-a-version"}`))
+				})
+
+				It("falls back to the v2 stats without counting the member as unreachable", func() {
+					Eventually(recordedContexts).Should(ConsistOf([]string{"version", "leader", "server", "store", "endpoint", "metrics_server"}))
+					Expect(notifier.HealthContexts()).To(Equal(map[string][]string{"": {"server", "store"}}))
+
+					context, _, _ := registry.Latest("", "endpoint")
+					Expect(context.Metrics[0].Value).To(Equal(1))
+				})
+			})
+
+			Context("and the member cannot be reached yet", func() {
+				BeforeEach(func() {
+					leader.RouteToHandler("GET", "/version", ghttp.RespondWith(503, ""))
+				})
+
+				It("only expects the version to be collected", func() {
+					Eventually(recordedContexts).Should(ConsistOf([]string{"version", "endpoint", "metrics_server"}))
+					Consistently(recordedContexts, 3*reportInterval).Should(Equal([]string{"version", "endpoint", "metrics_server"}))
+					Expect(notifier.HealthContexts()).To(Equal(map[string][]string{"": {"version"}}))
+
+					Eventually(func() interface{} {
+						context, _, _ := registry.Latest("", "endpoint")
+						return context.Metrics[0].Value
+					}).Should(Equal(0))
+				})
+			})
+
+			Context("and the member is upgraded", func() {
+				It("detects the new version once it is reachable again", func() {
+					Eventually(recordedContexts).Should(ContainElement("server"))
+
+					leader.RouteToHandler("GET", "/version", ghttp.RespondWith(200, fixtureV34Version))
+					leader.RouteToHandler("GET", "/v2/stats/self", ghttp.RespondWith(404, ""))
+
+					Eventually(recordedContexts, 5*reportInterval).Should(ContainElement("metrics"))
+					Expect(notifier.HealthContexts()).To(Equal(map[string][]string{"": {"metrics"}}))
+				})
 			})
 		})
 	})
 })
 
+var fixtureV2Version = `{"etcdserver":"2.3.7","etcdcluster":"2.3.0"}`
+
+var fixtureV34Version = `{"etcdserver":"3.4.13","etcdcluster":"3.4.0"}`
+
+var fixtureV3Metrics = `# TYPE etcd_server_has_leader gauge
+etcd_server_has_leader 1
+# TYPE etcd_server_is_leader gauge
+etcd_server_is_leader 1
+`
+
 var fixtureSelfFollowerStats = `
 {
   "name": "node1",
@@ -227,6 +992,19 @@ var fixtureLeaderStats = `
 		"fail": 4,
 		"success": 215000
 	  }
+	},
+	"node3-id": {
+	  "latency": {
+		"current": 0.312345,
+		"average": 0.14636559394884047,
+		"standardDeviation": 0.15477392607571758,
+		"minimum": 8.4e-05,
+		"maximum": 6.78157
+	  },
+	  "counts": {
+		"fail": 0,
+		"success": 215004
+	  }
 	}
   }
 }
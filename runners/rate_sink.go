@@ -0,0 +1,134 @@
+package runners
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+type CounterRates string
+
+const (
+	RawCounters           CounterRates = "raw"
+	CounterRatesAlongside CounterRates = "alongside"
+	CounterRatesInstead   CounterRates = "instead"
+)
+
+type counterSample struct {
+	value float64
+	at    time.Time
+}
+
+// RateSink turns the counter metrics sent to it into per-second rates, named
+// after the counter with a "Rate" suffix, before passing them on to the
+// wrapped sink. The samples of a member are dropped once it is forgotten.
+type RateSink struct {
+	sink  Sink
+	mode  CounterRates
+	clock clock.Clock
+
+	lock    sync.Mutex
+	samples map[string]counterSample
+}
+
+func NewRateSink(sink Sink, mode CounterRates, clock clock.Clock) (*RateSink, error) {
+	if mode != CounterRatesAlongside && mode != CounterRatesInstead {
+		return nil, fmt.Errorf("unknown counter rates mode %q", mode)
+	}
+
+	return &RateSink{
+		sink:    sink,
+		mode:    mode,
+		clock:   clock,
+		samples: map[string]counterSample{},
+	}, nil
+}
+
+func (sink *RateSink) Send(context instrumentation.Context) error {
+	sink.lock.Lock()
+	now := sink.clock.Now()
+
+	metrics := make([]instrumentation.Metric, 0, len(context.Metrics))
+	for _, metric := range context.Metrics {
+		if metric.Kind != instrumentation.Counter {
+			metrics = append(metrics, metric)
+			continue
+		}
+
+		if sink.mode == CounterRatesAlongside {
+			metrics = append(metrics, metric)
+		}
+
+		rate, ok := sink.rate(counterKey(context, metric), convertToFloat64(metric.Value), now)
+		if ok {
+			rateMetric := instrumentation.Metric{
+				Name:  metric.Name + "Rate",
+				Value: rate,
+				Tags:  metric.Tags,
+			}
+			if metric.Unit != "" {
+				rateMetric.Unit = metric.Unit + "/s"
+			}
+
+			metrics = append(metrics, rateMetric)
+		}
+	}
+	sink.lock.Unlock()
+
+	context.Metrics = metrics
+	return sink.sink.Send(context)
+}
+
+func (sink *RateSink) Flush() error {
+	if flusher, ok := sink.sink.(Flusher); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+func (sink *RateSink) Forget(member string) {
+	sink.lock.Lock()
+	for key := range sink.samples {
+		if strings.HasPrefix(key, member+"\x00") {
+			delete(sink.samples, key)
+		}
+	}
+	sink.lock.Unlock()
+
+	if forgetter, ok := sink.sink.(Forgetter); ok {
+		forgetter.Forget(member)
+	}
+}
+
+// rate records the sample and returns the per-second increase since the
+// previous one. There is none for the first sample, nor when the counter went
+// down because the etcd member restarted.
+func (sink *RateSink) rate(key string, value float64, now time.Time) (float64, bool) {
+	previous, found := sink.samples[key]
+	sink.samples[key] = counterSample{value: value, at: now}
+
+	if !found || value < previous.value {
+		return 0, false
+	}
+
+	elapsed := now.Sub(previous.at).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+
+	return (value - previous.value) / elapsed, true
+}
+
+func counterKey(context instrumentation.Context, metric instrumentation.Metric) string {
+	parts := []string{context.Member, context.Name, metric.Name}
+	for _, key := range sortedTagKeys(metric.Tags) {
+		parts = append(parts, fmt.Sprintf("%s=%v", key, metric.Tags[key]))
+	}
+
+	return strings.Join(parts, "\x00")
+}
@@ -0,0 +1,149 @@
+package runners_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/fakes"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateSink", func() {
+	var (
+		fakeSink  *fakes.Sink
+		fakeClock *fakeclock.FakeClock
+		mode      runners.CounterRates
+		sink      *runners.RateSink
+	)
+
+	storeContext := func(gets uint64, follower float64) instrumentation.Context {
+		return instrumentation.Context{
+			Name: "store",
+			Metrics: []instrumentation.Metric{
+				{Name: "Watchers", Value: 3},
+				{Name: "GetsSuccess", Value: gets, Kind: instrumentation.Counter},
+				{Name: "PeerSentBytes", Value: follower, Tags: map[string]interface{}{"to": "node2"}, Kind: instrumentation.Counter, Unit: instrumentation.BytesUnit},
+			},
+		}
+	}
+
+	sent := func() []instrumentation.Metric {
+		contexts := fakeSink.SentContexts()
+		return contexts[len(contexts)-1].Metrics
+	}
+
+	BeforeEach(func() {
+		fakeSink = &fakes.Sink{}
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1475280000, 0))
+		mode = runners.CounterRatesAlongside
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		sink, err = runners.NewRateSink(fakeSink, mode, fakeClock)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("sends the counters alongside their rate since the previous interval", func() {
+		Expect(sink.Send(storeContext(100, 1000))).To(Succeed())
+		Expect(sent()).To(Equal(storeContext(100, 1000).Metrics))
+
+		fakeClock.Increment(10 * time.Second)
+		Expect(sink.Send(storeContext(150, 3000))).To(Succeed())
+		Expect(sent()).To(Equal([]instrumentation.Metric{
+			{Name: "Watchers", Value: 3},
+			{Name: "GetsSuccess", Value: uint64(150), Kind: instrumentation.Counter},
+			{Name: "GetsSuccessRate", Value: 5.0},
+			{Name: "PeerSentBytes", Value: 3000.0, Tags: map[string]interface{}{"to": "node2"}, Kind: instrumentation.Counter, Unit: instrumentation.BytesUnit},
+			{Name: "PeerSentBytesRate", Value: 200.0, Tags: map[string]interface{}{"to": "node2"}, Unit: instrumentation.BytesPerSecondUnit},
+		}))
+	})
+
+	It("keeps a separate sample for every member and tag set", func() {
+		Expect(sink.Send(storeContext(100, 1000))).To(Succeed())
+
+		other := storeContext(10, 10)
+		other.Member = "node2"
+		Expect(sink.Send(other)).To(Succeed())
+
+		fakeClock.Increment(10 * time.Second)
+		other = storeContext(20, 10)
+		other.Member = "node2"
+		Expect(sink.Send(other)).To(Succeed())
+
+		Expect(sent()).To(ContainElement(instrumentation.Metric{Name: "GetsSuccessRate", Value: 1.0}))
+	})
+
+	It("drops the samples of a member once it is forgotten", func() {
+		node := func(member string, gets uint64) instrumentation.Context {
+			context := storeContext(gets, 1000)
+			context.Member = member
+			return context
+		}
+
+		Expect(sink.Send(node("node1", 100))).To(Succeed())
+		Expect(sink.Send(node("node2", 100))).To(Succeed())
+
+		sink.Forget("node1")
+		Expect(fakeSink.ForgottenMembers()).To(Equal([]string{"node1"}))
+
+		fakeClock.Increment(10 * time.Second)
+		Expect(sink.Send(node("node1", 200))).To(Succeed())
+		Expect(sent()).NotTo(ContainElement(instrumentation.Metric{Name: "GetsSuccessRate", Value: 10.0}))
+
+		Expect(sink.Send(node("node2", 200))).To(Succeed())
+		Expect(sent()).To(ContainElement(instrumentation.Metric{Name: "GetsSuccessRate", Value: 10.0}))
+	})
+
+	It("does not send a rate when the counter was reset", func() {
+		Expect(sink.Send(storeContext(100, 1000))).To(Succeed())
+
+		fakeClock.Increment(10 * time.Second)
+		Expect(sink.Send(storeContext(20, 1000))).To(Succeed())
+		Expect(sent()).NotTo(ContainElement(instrumentation.Metric{Name: "GetsSuccessRate", Value: 0.0}))
+		Expect(sent()).To(HaveLen(4))
+
+		fakeClock.Increment(10 * time.Second)
+		Expect(sink.Send(storeContext(40, 1000))).To(Succeed())
+		Expect(sent()).To(ContainElement(instrumentation.Metric{Name: "GetsSuccessRate", Value: 2.0}))
+	})
+
+	Context("when the rates are sent instead of the counters", func() {
+		BeforeEach(func() {
+			mode = runners.CounterRatesInstead
+		})
+
+		It("only sends the rates", func() {
+			Expect(sink.Send(storeContext(100, 1000))).To(Succeed())
+			Expect(sent()).To(Equal([]instrumentation.Metric{{Name: "Watchers", Value: 3}}))
+
+			fakeClock.Increment(10 * time.Second)
+			Expect(sink.Send(storeContext(150, 1000))).To(Succeed())
+			Expect(sent()).To(Equal([]instrumentation.Metric{
+				{Name: "Watchers", Value: 3},
+				{Name: "GetsSuccessRate", Value: 5.0},
+				{Name: "PeerSentBytesRate", Value: 0.0, Tags: map[string]interface{}{"to": "node2"}, Unit: instrumentation.BytesPerSecondUnit},
+			}))
+		})
+	})
+
+	It("returns the error of the wrapped sink", func() {
+		fakeSink.SendCall.Returns.Error = errors.New("boom")
+		Expect(sink.Send(storeContext(100, 1000))).To(MatchError("boom"))
+	})
+
+	It("flushes the wrapped sink", func() {
+		Expect(sink.Flush()).To(Succeed())
+		Expect(fakeSink.FlushCallCount()).To(Equal(1))
+	})
+
+	It("rejects unknown modes", func() {
+		_, err := runners.NewRateSink(fakeSink, runners.CounterRates("sometimes"), fakeClock)
+		Expect(err).To(MatchError(`unknown counter rates mode "sometimes"`))
+	})
+})
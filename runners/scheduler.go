@@ -0,0 +1,143 @@
+package runners
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// instrumentNames are the instruments whose scrape interval can be set.
+var instrumentNames = []string{"version", "leader", "server", "store", "metrics", "status"}
+
+// ScrapeIntervals sets the interval of some instruments, keyed by instrument
+// name. The others are scraped every report interval.
+type ScrapeIntervals map[string]time.Duration
+
+// ParseScrapeIntervals parses a comma separated list of instrument=interval
+// pairs, e.g. server=5s,store=1m.
+func ParseScrapeIntervals(value string) (ScrapeIntervals, error) {
+	intervals := ScrapeIntervals{}
+	if value == "" {
+		return intervals, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid scrape interval %q: expected instrument=interval", pair)
+		}
+
+		name := strings.TrimSpace(parts[0])
+		if !isInstrumentName(name) {
+			return nil, fmt.Errorf("unknown instrument %q: expected one of %s", name, strings.Join(instrumentNames, ", "))
+		}
+
+		interval, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid scrape interval for %s: %s", name, err)
+		}
+
+		intervals[name] = interval
+	}
+
+	return intervals, nil
+}
+
+// Validate checks that every interval is positive.
+func (intervals ScrapeIntervals) Validate() error {
+	names := make([]string, 0, len(intervals))
+	for name := range intervals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if intervals[name] <= 0 {
+			return fmt.Errorf("the scrape interval of %s (%s) is not positive", name, intervals[name])
+		}
+	}
+
+	return nil
+}
+
+// Tick returns how often the scheduler is consulted: every report interval,
+// or more often when an instrument is scraped more often than that.
+func (intervals ScrapeIntervals) Tick(reportInterval time.Duration) time.Duration {
+	tick := reportInterval
+	for _, interval := range intervals {
+		if interval < tick {
+			tick = interval
+		}
+	}
+
+	return tick
+}
+
+// Longest returns the longest interval at which any instrument is scraped.
+func (intervals ScrapeIntervals) Longest(reportInterval time.Duration) time.Duration {
+	longest := reportInterval
+	for _, interval := range intervals {
+		if interval > longest {
+			longest = interval
+		}
+	}
+
+	return longest
+}
+
+func isInstrumentName(name string) bool {
+	for _, instrumentName := range instrumentNames {
+		if name == instrumentName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scheduler decides on every tick which instruments are due. Each instrument
+// is scheduled again after its interval varied by up to jitter, a fraction of
+// the interval, so that servers started together drift apart instead of all
+// scraping etcd at the same moment.
+type scheduler struct {
+	tick           time.Duration
+	reportInterval time.Duration
+	intervals      ScrapeIntervals
+	jitter         float64
+}
+
+func newScheduler(reportInterval time.Duration, intervals ScrapeIntervals, jitter float64) *scheduler {
+	return &scheduler{
+		tick:           intervals.Tick(reportInterval),
+		reportInterval: reportInterval,
+		intervals:      intervals,
+		jitter:         jitter,
+	}
+}
+
+// due reports whether the scraper should be scraped at now, and if so
+// schedules its next scrape. Being due within half a tick is good enough, as
+// the scheduler is not consulted again before then.
+func (s *scheduler) due(sc *scraper, now time.Time) bool {
+	if now.Add(s.tick / 2).Before(sc.next) {
+		return false
+	}
+
+	sc.next = now.Add(s.interval(sc.name))
+	return true
+}
+
+func (s *scheduler) interval(name string) time.Duration {
+	interval, found := s.intervals[name]
+	if !found {
+		interval = s.reportInterval
+	}
+
+	if s.jitter == 0 {
+		return interval
+	}
+
+	return interval + time.Duration((rand.Float64()*2-1)*s.jitter*float64(interval))
+}
@@ -0,0 +1,58 @@
+package runners_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ScrapeIntervals", func() {
+	Describe("ParseScrapeIntervals", func() {
+		It("parses instrument=interval pairs", func() {
+			intervals, err := runners.ParseScrapeIntervals("server=5s, store=1m")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(intervals).To(Equal(runners.ScrapeIntervals{
+				"server": 5 * time.Second,
+				"store":  time.Minute,
+			}))
+		})
+
+		It("returns no intervals for an empty list", func() {
+			intervals, err := runners.ParseScrapeIntervals("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(intervals).To(BeEmpty())
+		})
+
+		It("rejects unknown instruments", func() {
+			_, err := runners.ParseScrapeIntervals("IsLeader=5s")
+			Expect(err).To(MatchError(`unknown instrument "IsLeader": expected one of version, leader, server, store, metrics, status`))
+		})
+
+		It("rejects malformed pairs", func() {
+			_, err := runners.ParseScrapeIntervals("store")
+			Expect(err).To(MatchError(`invalid scrape interval "store": expected instrument=interval`))
+
+			_, err = runners.ParseScrapeIntervals("store=often")
+			Expect(err).To(MatchError(ContainSubstring("invalid scrape interval for store")))
+		})
+	})
+
+	It("rejects intervals that are not positive", func() {
+		Expect(runners.ScrapeIntervals{"server": 5 * time.Second, "store": time.Minute}.Validate()).To(Succeed())
+		Expect(runners.ScrapeIntervals{"server": 0}.Validate()).To(MatchError("the scrape interval of server (0s) is not positive"))
+	})
+
+	It("ticks at the shortest of the report interval and the scrape intervals", func() {
+		Expect(runners.ScrapeIntervals{}.Tick(time.Minute)).To(Equal(time.Minute))
+		Expect(runners.ScrapeIntervals{"store": 5 * time.Minute}.Tick(time.Minute)).To(Equal(time.Minute))
+		Expect(runners.ScrapeIntervals{"server": 5 * time.Second, "store": 5 * time.Minute}.Tick(time.Minute)).To(Equal(5 * time.Second))
+	})
+
+	It("returns the longest interval", func() {
+		Expect(runners.ScrapeIntervals{}.Longest(5 * time.Second)).To(Equal(5 * time.Second))
+		Expect(runners.ScrapeIntervals{"store": time.Minute}.Longest(5 * time.Second)).To(Equal(time.Minute))
+	})
+})
@@ -0,0 +1,47 @@
+package runners
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+// scraper collects a single instrument of a member and keeps track of how its
+// scrapes went, for the metrics server's own metrics.
+type scraper struct {
+	name      string
+	collector instrumentation.Collector
+
+	failures  int
+	succeeded uint64
+	failed    uint64
+	duration  time.Duration
+
+	next time.Time
+}
+
+func newScraper(name string, collector instrumentation.Collector) *scraper {
+	return &scraper{
+		name:      name,
+		collector: collector,
+	}
+}
+
+// scrape returns the context collected by the instrument, or an empty one with
+// the error when it failed.
+func (s *scraper) scrape(ctx context.Context) (instrumentation.Context, error) {
+	started := time.Now()
+	collected, err := s.collector.Collect(ctx)
+	s.duration = time.Since(started)
+
+	if err != nil {
+		s.failures++
+		s.failed++
+		return instrumentation.Context{Name: s.name}, err
+	}
+
+	s.failures = 0
+	s.succeeded++
+	return collected, nil
+}
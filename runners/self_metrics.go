@@ -0,0 +1,104 @@
+package runners
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+// selfContextName names the context of the metrics server's own metrics,
+// which tell a failing exporter apart from a failing etcd.
+const selfContextName = "metrics_server"
+
+// selfContext reports how the last scrape of every instrument of the members
+// went, how many metrics were emitted on this interval, the errors of the
+// sinks and ticks dropped so far, and the Go runtime of the server.
+func (n *PeriodicMetronNotifier) selfContext(members []*member, emitted int) instrumentation.Context {
+	context := instrumentation.Context{
+		Name: selfContextName,
+	}
+
+	for _, m := range members {
+		for _, s := range m.scraped {
+			tags := map[string]interface{}{"instrument": s.name}
+			if m.Name != "" {
+				tags["member"] = m.Name
+			}
+
+			context.Metrics = append(context.Metrics,
+				instrumentation.Metric{
+					Name:  "ScrapeDuration",
+					Value: s.duration.Seconds(),
+					Tags:  tags,
+					Unit:  instrumentation.SecondsUnit,
+				},
+				instrumentation.Metric{
+					Name:  "ScrapesSucceeded",
+					Value: s.succeeded,
+					Tags:  tags,
+					Kind:  instrumentation.Counter,
+				},
+				instrumentation.Metric{
+					Name:  "ScrapesFailed",
+					Value: s.failed,
+					Tags:  tags,
+					Kind:  instrumentation.Counter,
+				},
+			)
+		}
+	}
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	context.Metrics = append(context.Metrics,
+		instrumentation.Metric{
+			Name:  "MetricsEmitted",
+			Value: emitted,
+		},
+		instrumentation.Metric{
+			Name:  "SinkErrors",
+			Value: n.sinkErrors,
+			Kind:  instrumentation.Counter,
+		},
+		instrumentation.Metric{
+			Name:  "DroppedTicks",
+			Value: n.droppedTicks,
+			Kind:  instrumentation.Counter,
+		},
+		instrumentation.Metric{
+			Name:  "Goroutines",
+			Value: runtime.NumGoroutine(),
+		},
+		instrumentation.Metric{
+			Name:  "HeapAlloc",
+			Value: memStats.HeapAlloc,
+			Unit:  instrumentation.BytesUnit,
+		},
+		instrumentation.Metric{
+			Name: "GCPause",
+			Value: instrumentation.SummaryValue{
+				Count: uint64(memStats.NumGC),
+				Sum:   time.Duration(memStats.PauseTotalNs).Seconds(),
+			},
+			Kind: instrumentation.Summary,
+			Unit: instrumentation.SecondsUnit,
+		},
+	)
+
+	return context
+}
+
+// countDroppedTicks counts the ticks the ticker dropped since the previous one
+// because collecting took longer than the interval.
+func (n *PeriodicMetronNotifier) countDroppedTicks(previous, tick time.Time) {
+	if previous.IsZero() {
+		return
+	}
+
+	intervals := int64((tick.Sub(previous) + n.interval/2) / n.interval)
+	if intervals > 1 {
+		n.droppedTicks += uint64(intervals - 1)
+	}
+}
@@ -0,0 +1,88 @@
+package runners
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+// maxDatagramSize keeps each UDP datagram sent by a sink within a typical
+// Ethernet MTU.
+const maxDatagramSize = 1432
+
+// Sink is a destination for the metrics collected on each report interval.
+type Sink interface {
+	Send(context instrumentation.Context) error
+}
+
+// Flusher is implemented by sinks that batch metrics. Flush is called once all
+// the metrics collected on a report interval have been sent.
+type Flusher interface {
+	Flush() error
+}
+
+// Forgetter is implemented by sinks that keep state for each series. Forget is
+// called once a member has been removed or renamed, to drop the state of the
+// series tagged with its name.
+type Forgetter interface {
+	Forget(member string)
+}
+
+func convertToFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case uint64:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	default:
+		msg := fmt.Sprintf("invalid type %v", reflect.TypeOf(value).Name())
+		panic(msg)
+	}
+}
+
+func sortedTagKeys(tags map[string]interface{}) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// flattenSummaries replaces every summary metric with a Count counter and a
+// Sum, for sinks that can only send numbers. The sum is sent as a gauge as it
+// is rarely a whole number, which dropsonde and Loggregator counters must be.
+func flattenSummaries(metrics []instrumentation.Metric) []instrumentation.Metric {
+	flattened := make([]instrumentation.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		summary, ok := metric.Value.(instrumentation.SummaryValue)
+		if metric.Kind != instrumentation.Summary || !ok {
+			flattened = append(flattened, metric)
+			continue
+		}
+
+		flattened = append(flattened,
+			instrumentation.Metric{
+				Name:  metric.Name + "Count",
+				Value: summary.Count,
+				Tags:  metric.Tags,
+				Kind:  instrumentation.Counter,
+			},
+			instrumentation.Metric{
+				Name:  metric.Name + "Sum",
+				Value: summary.Sum,
+				Tags:  metric.Tags,
+				Unit:  metric.Unit,
+			},
+		)
+	}
+
+	return flattened
+}
@@ -0,0 +1,122 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+type srvResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// SRVDiscoverer finds the members to monitor through the DNS SRV records etcd
+// itself uses for discovery. The client records, _etcd-client._tcp or
+// _etcd-client-ssl._tcp, are preferred; when a domain only publishes the
+// server records, which point at the peer port, their hosts are used with
+// clientPort instead. The records are resolved again once refreshInterval has
+// passed.
+type SRVDiscoverer struct {
+	resolver        srvResolver
+	domain          string
+	scheme          string
+	clientPort      string
+	refreshInterval time.Duration
+	clock           clock.Clock
+	names           *memberNames
+
+	etcdURLs   []string
+	resolvedAt time.Time
+}
+
+func NewSRVDiscoverer(
+	resolver srvResolver,
+	domain string,
+	scheme string,
+	clientPort string,
+	refreshInterval time.Duration,
+	getter getter,
+	clock clock.Clock,
+) *SRVDiscoverer {
+	return &SRVDiscoverer{
+		resolver:        resolver,
+		domain:          domain,
+		scheme:          scheme,
+		clientPort:      clientPort,
+		refreshInterval: refreshInterval,
+		clock:           clock,
+		names:           newMemberNames(getter),
+	}
+}
+
+func (d *SRVDiscoverer) Discover(ctx context.Context, reachable func(etcdURL string) bool) ([]EtcdMember, error) {
+	if d.etcdURLs == nil || d.clock.Since(d.resolvedAt) >= d.refreshInterval {
+		etcdURLs, err := d.resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		d.etcdURLs = etcdURLs
+		d.resolvedAt = d.clock.Now()
+	}
+
+	return d.names.members(ctx, d.etcdURLs, reachable), nil
+}
+
+func (d *SRVDiscoverer) resolve(ctx context.Context) ([]string, error) {
+	suffix := ""
+	if d.scheme == "https" {
+		suffix = "-ssl"
+	}
+
+	records, clientErr := d.lookup(ctx, "etcd-client"+suffix)
+	if clientErr == nil && len(records) > 0 {
+		return d.urls(records, ""), nil
+	}
+
+	records, serverErr := d.lookup(ctx, "etcd-server"+suffix)
+	if serverErr == nil && len(records) > 0 {
+		return d.urls(records, d.clientPort), nil
+	}
+
+	if serverErr == nil {
+		serverErr = fmt.Errorf("no records found")
+	}
+
+	return nil, fmt.Errorf("failed to resolve etcd SRV records for %s: %s", d.domain, serverErr)
+}
+
+func (d *SRVDiscoverer) lookup(ctx context.Context, service string) ([]*net.SRV, error) {
+	_, records, err := d.resolver.LookupSRV(ctx, service, "tcp", d.domain)
+	return records, err
+}
+
+func (d *SRVDiscoverer) urls(records []*net.SRV, port string) []string {
+	etcdURLs := make([]string, 0, len(records))
+
+	for _, record := range records {
+		recordPort := port
+		if recordPort == "" {
+			recordPort = strconv.Itoa(int(record.Port))
+		}
+
+		etcdURL := &url.URL{
+			Scheme: d.scheme,
+			Host:   net.JoinHostPort(strings.TrimSuffix(record.Target, "."), recordPort),
+		}
+		etcdURLs = append(etcdURLs, etcdURL.String())
+	}
+
+	// resolvers shuffle records of equal priority, so keep the members in a
+	// stable order
+	sort.Strings(etcdURLs)
+
+	return etcdURLs
+}
@@ -0,0 +1,170 @@
+package runners_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/fakes"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeResolver struct {
+	records map[string][]*net.SRV
+	err     error
+	lookups []string
+	ctx     context.Context
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	query := "_" + service + "._" + proto + "." + name
+	r.lookups = append(r.lookups, query)
+	r.ctx = ctx
+
+	if r.err != nil {
+		return "", nil, r.err
+	}
+
+	return query, r.records[query], nil
+}
+
+var _ = Describe("SRVDiscoverer", func() {
+	var (
+		resolver   *fakeResolver
+		fakeGetter *fakes.Getter
+		fakeClock  *fakeclock.FakeClock
+		scheme     string
+		discoverer *runners.SRVDiscoverer
+	)
+
+	BeforeEach(func() {
+		resolver = &fakeResolver{records: map[string][]*net.SRV{}}
+		fakeGetter = &fakes.Getter{}
+		// member names are looked up over HTTP; failing them names each member
+		// after its address
+		fakeGetter.GetCall.Returns.Error = errors.New("connection refused")
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		scheme = "http"
+	})
+
+	JustBeforeEach(func() {
+		discoverer = runners.NewSRVDiscoverer(resolver, "etcd.service.cf.internal", scheme, "4001", time.Minute, fakeGetter, fakeClock)
+	})
+
+	Context("when the client records are published", func() {
+		BeforeEach(func() {
+			resolver.records["_etcd-client._tcp.etcd.service.cf.internal"] = []*net.SRV{
+				{Target: "etcd-1.etcd.service.cf.internal.", Port: 4001},
+				{Target: "etcd-0.etcd.service.cf.internal.", Port: 4001},
+			}
+		})
+
+		It("monitors each target on its client port", func() {
+			members, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(Equal([]runners.EtcdMember{
+				{Name: "etcd-0.etcd.service.cf.internal:4001", URL: "http://etcd-0.etcd.service.cf.internal:4001"},
+				{Name: "etcd-1.etcd.service.cf.internal:4001", URL: "http://etcd-1.etcd.service.cf.internal:4001"},
+			}))
+		})
+
+		It("resolves the records again once the refresh interval has passed", func() {
+			_, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+
+			resolver.records["_etcd-client._tcp.etcd.service.cf.internal"] = []*net.SRV{
+				{Target: "etcd-0.etcd.service.cf.internal.", Port: 4001},
+			}
+
+			fakeClock.Increment(59 * time.Second)
+			members, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(HaveLen(2))
+
+			fakeClock.Increment(time.Second)
+			members, err = discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(HaveLen(1))
+		})
+	})
+
+	Context("when etcd is served over TLS", func() {
+		BeforeEach(func() {
+			scheme = "https"
+			resolver.records["_etcd-client-ssl._tcp.etcd.service.cf.internal"] = []*net.SRV{
+				{Target: "etcd-0.etcd.service.cf.internal.", Port: 4001},
+			}
+		})
+
+		It("uses the ssl records", func() {
+			members, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(Equal([]runners.EtcdMember{
+				{Name: "etcd-0.etcd.service.cf.internal:4001", URL: "https://etcd-0.etcd.service.cf.internal:4001"},
+			}))
+		})
+	})
+
+	Context("when only the server records are published", func() {
+		BeforeEach(func() {
+			resolver.records["_etcd-server._tcp.etcd.service.cf.internal"] = []*net.SRV{
+				{Target: "etcd-0.etcd.service.cf.internal.", Port: 7001},
+			}
+		})
+
+		It("monitors each target on the client port", func() {
+			members, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(Equal([]runners.EtcdMember{
+				{Name: "etcd-0.etcd.service.cf.internal:4001", URL: "http://etcd-0.etcd.service.cf.internal:4001"},
+			}))
+			Expect(resolver.lookups).To(Equal([]string{
+				"_etcd-client._tcp.etcd.service.cf.internal",
+				"_etcd-server._tcp.etcd.service.cf.internal",
+			}))
+		})
+	})
+
+	Context("when no records are published", func() {
+		It("returns an error", func() {
+			_, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).To(MatchError("failed to resolve etcd SRV records for etcd.service.cf.internal: no records found"))
+		})
+	})
+
+	Context("when the lookup fails", func() {
+		BeforeEach(func() {
+			resolver.err = errors.New("i/o timeout")
+		})
+
+		It("returns an error and tries again next time", func() {
+			_, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).To(MatchError("failed to resolve etcd SRV records for etcd.service.cf.internal: i/o timeout"))
+
+			resolver.err = nil
+			resolver.records["_etcd-client._tcp.etcd.service.cf.internal"] = []*net.SRV{
+				{Target: "etcd-0.etcd.service.cf.internal.", Port: 4001},
+			}
+
+			members, err := discoverer.Discover(context.Background(), everyMember)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(members).To(HaveLen(1))
+		})
+	})
+
+	It("resolves the records within the deadline of the discovery", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		discoverer.Discover(ctx, everyMember)
+
+		deadline, ok := resolver.ctx.Deadline()
+		Expect(ok).To(BeTrue())
+		Expect(deadline).To(BeTemporally("<=", time.Now().Add(time.Second)))
+	})
+})
@@ -0,0 +1,95 @@
+package runners
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+)
+
+var statsdEscaper = strings.NewReplacer(":", "_", "|", "_", "@", "_", ",", "_", "#", "_", "\n", "_")
+
+// StatsdSink sends metrics as StatsD gauges over UDP, with tags in the
+// DogStatsD "#key:value" syntax.
+type StatsdSink struct {
+	conn   net.Conn
+	prefix string
+}
+
+func NewStatsdSink(address, prefix string) (*StatsdSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsdSink{
+		conn:   conn,
+		prefix: prefix,
+	}, nil
+}
+
+// Send sends every metric of the context, even when some of the packets
+// cannot be written, and returns their errors.
+func (sink *StatsdSink) Send(context instrumentation.Context) error {
+	var errs []error
+	packet := &bytes.Buffer{}
+
+	for _, metric := range flattenSummaries(context.Metrics) {
+		line := sink.format(context.Name, metric)
+
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxDatagramSize {
+			err := sink.write(packet)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		err := sink.write(packet)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (sink *StatsdSink) write(packet *bytes.Buffer) error {
+	_, err := sink.conn.Write(packet.Bytes())
+	packet.Reset()
+	return err
+}
+
+// format returns the lines setting the gauge of the metric. StatsD reads a
+// negative gauge value as a decrement, so a negative value is sent after
+// setting the gauge to 0.
+func (sink *StatsdSink) format(contextName string, metric instrumentation.Metric) string {
+	name := statsdEscaper.Replace(sink.prefix + contextName + "." + metric.Name)
+	value := convertToFloat64(metric.Value)
+
+	suffix := "|g"
+	if len(metric.Tags) > 0 {
+		tags := make([]string, 0, len(metric.Tags))
+		for _, key := range sortedTagKeys(metric.Tags) {
+			tags = append(tags, statsdEscaper.Replace(key)+":"+statsdEscaper.Replace(fmt.Sprint(metric.Tags[key])))
+		}
+		suffix += "|#" + strings.Join(tags, ",")
+	}
+
+	line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + suffix
+	if value < 0 {
+		line = name + ":0" + suffix + "\n" + line
+	}
+
+	return line
+}
@@ -0,0 +1,95 @@
+package runners_test
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
+	"github.com/cloudfoundry-incubator/etcd-metrics-server/runners"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StatsdSink", func() {
+	var (
+		statsd net.PacketConn
+		sink   *runners.StatsdSink
+	)
+
+	readPacket := func() string {
+		buffer := make([]byte, 65536)
+		statsd.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := statsd.ReadFrom(buffer)
+		Expect(err).NotTo(HaveOccurred())
+		return string(buffer[:n])
+	}
+
+	BeforeEach(func() {
+		var err error
+		statsd, err = net.ListenPacket("udp4", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		sink, err = runners.NewStatsdSink(statsd.LocalAddr().String(), "etcd.")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		statsd.Close()
+	})
+
+	It("sends each metric as a gauge with its tags in DogStatsD syntax", func() {
+		err := sink.Send(instrumentation.Context{
+			Name: "leader",
+			Metrics: []instrumentation.Metric{
+				{Name: "Followers", Value: 2},
+				{Name: "Latency", Value: 0.153507, Tags: map[string]interface{}{"follower": "node1", "cluster": "a:b"}},
+				{Name: "SentAppendRequests", Value: uint64(4321)},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(readPacket()).To(Equal(strings.Join([]string{
+			"etcd.leader.Followers:2|g",
+			"etcd.leader.Latency:0.153507|g|#cluster:a_b,follower:node1",
+			"etcd.leader.SentAppendRequests:4321|g",
+		}, "\n")))
+	})
+
+	It("resets gauges to 0 before sending a negative value, which StatsD would read as a decrement", func() {
+		err := sink.Send(instrumentation.Context{
+			Name: "server",
+			Metrics: []instrumentation.Metric{
+				{Name: "Skew", Value: -5, Tags: map[string]interface{}{"member": "node1"}},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(readPacket()).To(Equal(strings.Join([]string{
+			"etcd.server.Skew:0|g|#member:node1",
+			"etcd.server.Skew:-5|g|#member:node1",
+		}, "\n")))
+	})
+
+	It("splits large contexts across several packets", func() {
+		metrics := []instrumentation.Metric{}
+		for i := 0; i < 100; i++ {
+			metrics = append(metrics, instrumentation.Metric{Name: "Watchers", Value: i})
+		}
+
+		err := sink.Send(instrumentation.Context{Name: "store", Metrics: metrics})
+		Expect(err).NotTo(HaveOccurred())
+
+		lines := []string{}
+		for len(lines) < 100 {
+			packet := readPacket()
+			Expect(len(packet)).To(BeNumerically("<=", 1432))
+			lines = append(lines, strings.Split(packet, "\n")...)
+		}
+
+		Expect(lines).To(HaveLen(100))
+		Expect(lines[0]).To(Equal("etcd.store.Watchers:0|g"))
+		Expect(lines[99]).To(Equal("etcd.store.Watchers:99|g"))
+	})
+})
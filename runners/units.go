@@ -1,26 +1,14 @@
 package runners
 
-const (
-	MetricUnit            = "Metric"
-	BytesPerSecondUnit    = "B/s"
-	RequestsPerSecondUnit = "Req/s"
-)
+import "github.com/cloudfoundry-incubator/etcd-metrics-server/instrumentation"
 
-var (
-	unitMap = map[string]string{
-		"SendingRequestRate":     RequestsPerSecondUnit,
-		"SendingBandwidthRate":   BytesPerSecondUnit,
-		"ReceivingRequestRate":   RequestsPerSecondUnit,
-		"ReceivingBandwidthRate": BytesPerSecondUnit,
-	}
-)
-
-func GetMetricUnit(metric string) string {
-	unit, ok := unitMap[metric]
+// MetricUnit is the unit sent for metrics whose instrument did not set one.
+const MetricUnit = "Metric"
 
-	if !ok {
+func GetMetricUnit(metric instrumentation.Metric) string {
+	if metric.Unit == "" {
 		return MetricUnit
-	} else {
-		return unit
 	}
+
+	return metric.Unit
 }